@@ -0,0 +1,181 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// TagLastAccess is the object tag holding the last read time, RFC 3339 in UTC.
+const TagLastAccess = "last-access"
+
+// AccessTracker wraps an S3Storage and remembers when objects were read.
+// Reads are collected in memory and written as the TagLastAccess object tag
+// by Flush, so tracking adds no latency to reads and at most one tagging
+// request per object per flush.
+type AccessTracker struct {
+	*S3Storage
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+// NewAccessTracker creates an AccessTracker around s.
+func NewAccessTracker(s *S3Storage) *AccessTracker {
+	return &AccessTracker{S3Storage: s, pending: make(map[string]time.Time)}
+}
+
+func (t *AccessTracker) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := t.S3Storage.Open(ctx, path)
+	if err == nil {
+		t.record(path)
+	}
+	return rc, err
+}
+
+func (t *AccessTracker) Download(ctx context.Context, path string, w io.WriterAt) error {
+	err := t.S3Storage.Download(ctx, path, w)
+	if err == nil {
+		t.record(path)
+	}
+	return err
+}
+
+func (t *AccessTracker) record(path string) {
+	t.mu.Lock()
+	t.pending[path] = time.Now().UTC()
+	t.mu.Unlock()
+}
+
+// Flush writes the collected access times to object tags. Objects deleted
+// in the meantime are skipped; on other errors the remaining entries are
+// kept for the next flush.
+func (t *AccessTracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = make(map[string]time.Time)
+	t.mu.Unlock()
+
+	for path, at := range batch {
+		err := t.setTag(ctx, path, TagLastAccess, at.Format(time.RFC3339))
+		if err == nil || errors.Is(err, ErrNotFound) {
+			delete(batch, path)
+			continue
+		}
+
+		t.mu.Lock()
+		for p, a := range batch {
+			if cur, ok := t.pending[p]; !ok || cur.Before(a) {
+				t.pending[p] = a
+			}
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is done, then flushes once more.
+func (t *AccessTracker) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := t.Flush(context.WithoutCancel(ctx)); err != nil && onError != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// ColdCandidates returns objects under prefix that were neither read nor
+// written for longer than olderThan. The last read time comes from the
+// TagLastAccess tag, objects without it are judged by LastModified.
+// It needs one tagging request per object, so run it as a batch job.
+func (s *S3Storage) ColdCandidates(ctx context.Context, prefix string, olderThan time.Duration) ([]ObjectInfo, error) {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var candidates []ObjectInfo
+	for _, obj := range objects {
+		if obj.LastModified.After(cutoff) {
+			continue
+		}
+		tags, err := s.getTags(ctx, obj.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := tags[TagLastAccess]; ok {
+			if at, err := time.Parse(time.RFC3339, v); err == nil && at.After(cutoff) {
+				continue
+			}
+		}
+		candidates = append(candidates, obj)
+	}
+	return candidates, nil
+}
+
+// setTag sets one tag, keeping the other tags of the object.
+func (s *S3Storage) setTag(ctx context.Context, path, key, value string) error {
+	tags, err := s.getTags(ctx, path)
+	if err != nil {
+		return err
+	}
+	tags[key] = value
+	return s.putTags(ctx, path, tags)
+}
+
+func (s *S3Storage) getTags(ctx context.Context, path string) (map[string]string, error) {
+	resp, err := s.client().GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(path),
+	}, s.optFns(opRead)...)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, s.storageError("get tags", s.Bucket, path, ErrNotFound)
+		}
+		return nil, s.storageError("get tags", s.Bucket, path, err)
+	}
+	tags := make(map[string]string, len(resp.TagSet))
+	for _, tag := range resp.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+func (s *S3Storage) putTags(ctx context.Context, path string, tags map[string]string) error {
+	tagSet := make([]types.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := s.client().PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.Bucket),
+		Key:     aws.String(path),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	}, s.optFns(opWrite)...)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return s.storageError("set tags", s.Bucket, path, ErrNotFound)
+		}
+		return s.storageError("set tags", s.Bucket, path, err)
+	}
+	return nil
+}
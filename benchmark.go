@@ -0,0 +1,145 @@
+package s3storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type BenchmarkOptions struct {
+	// Prefix for the temporary test objects, "benchmark/" under
+	// Config.InternalPrefix by default.
+	Prefix string
+	// ObjectSize of every test object, 64MB by default.
+	ObjectSize int64
+	// PartSizes to try, 5, 16 and 64MB by default.
+	PartSizes []int64
+	// Concurrencies to try, 1, 4 and 8 by default.
+	Concurrencies []int
+}
+
+// BenchmarkResult is the throughput of one combination of settings.
+type BenchmarkResult struct {
+	PartSize     int64
+	Concurrency  int
+	UploadMBps   float64
+	DownloadMBps float64
+}
+
+// BenchmarkReport lists all results and the settings that moved the test
+// object up and down in the shortest total time, ready for Config.PartSize
+// and Config.Concurrency.
+type BenchmarkReport struct {
+	Results     []BenchmarkResult
+	PartSize    int64
+	Concurrency int
+}
+
+// Benchmark uploads and downloads a synthetic object with every combination
+// of part size and concurrency and reports the throughput, to tune Config
+// for the current network and provider. It transfers ObjectSize twice per
+// combination, so run it deliberately, not on every start.
+func (s *S3Storage) Benchmark(ctx context.Context, opts BenchmarkOptions) (*BenchmarkReport, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = s.internalKey("benchmark/")
+	}
+	if opts.ObjectSize <= 0 {
+		opts.ObjectSize = 64 << 20
+	}
+	if len(opts.PartSizes) == 0 {
+		opts.PartSizes = []int64{5 << 20, 16 << 20, 64 << 20}
+	}
+	if len(opts.Concurrencies) == 0 {
+		opts.Concurrencies = []int{1, 4, 8}
+	}
+
+	// Random data, so compressing proxies don't skew the numbers.
+	chunk := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(chunk)
+
+	report := &BenchmarkReport{}
+	best := time.Duration(-1)
+	for _, partSize := range opts.PartSizes {
+		for _, concurrency := range opts.Concurrencies {
+			key := fmt.Sprintf("%sp%d-c%d", opts.Prefix, partSize, concurrency)
+			up, down, err := s.benchmarkOne(ctx, key, chunk, opts.ObjectSize, partSize, concurrency)
+			if err != nil {
+				return nil, err
+			}
+
+			mb := float64(opts.ObjectSize) / (1 << 20)
+			report.Results = append(report.Results, BenchmarkResult{
+				PartSize:     partSize,
+				Concurrency:  concurrency,
+				UploadMBps:   mb / up.Seconds(),
+				DownloadMBps: mb / down.Seconds(),
+			})
+			if total := up + down; best < 0 || total < best {
+				best = total
+				report.PartSize = partSize
+				report.Concurrency = concurrency
+			}
+		}
+	}
+	return report, nil
+}
+
+func (s *S3Storage) benchmarkOne(ctx context.Context, key string, chunk []byte, size, partSize int64, concurrency int) (up, down time.Duration, err error) {
+	base := s.uploader()
+	uploader := manager.NewUploader(s.client(), func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+		u.RequestChecksumCalculation = base.RequestChecksumCalculation
+	}, s.uploaderOpts(opWrite))
+	downloader := manager.NewDownloader(s.client(), func(d *manager.Downloader) {
+		d.PartSize = partSize
+		d.Concurrency = concurrency
+	}, s.downloaderOpts(opRead))
+	defer s.Delete(context.WithoutCancel(ctx), key)
+
+	start := time.Now()
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+		Body:   io.LimitReader(&repeatReader{chunk: chunk}, size),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("benchmark upload of %s to %s failed: %w", key, s.Bucket, err)
+	}
+	up = time.Since(start)
+
+	start = time.Now()
+	_, err = downloader.Download(ctx, discardWriterAt{}, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("benchmark download of %s from %s failed: %w", key, s.Bucket, err)
+	}
+	down = time.Since(start)
+	return up, down, nil
+}
+
+// repeatReader endlessly repeats chunk.
+type repeatReader struct {
+	chunk []byte
+	off   int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.chunk[r.off:])
+	r.off = (r.off + n) % len(r.chunk)
+	return n, nil
+}
+
+type discardWriterAt struct{}
+
+func (discardWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,109 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// abortTimeout bounds the cleanup of a failed multipart upload, which runs
+// after the caller's deadline has already passed.
+const abortTimeout = 30 * time.Second
+
+var ErrUploadTimeout = errors.New("upload deadline exceeded")
+
+// UploadTimeoutError is returned by Save when the deadline set with
+// WithDeadline or WithMaxDuration passes. It matches ErrUploadTimeout
+// with errors.Is.
+type UploadTimeoutError struct {
+	Path string
+	// Bytes is how much of the body was consumed before the deadline.
+	Bytes int64
+	// UploadID is the aborted multipart upload, empty for single part uploads.
+	UploadID string
+	// AbortErr is set if the uploaded parts could not be removed. They
+	// keep being billed until removed by a lifecycle rule or by hand.
+	AbortErr error
+	Err      error
+}
+
+func (e *UploadTimeoutError) Error() string {
+	msg := fmt.Sprintf("upload of %s timed out after %d bytes", e.Path, e.Bytes)
+	if e.AbortErr != nil {
+		msg += fmt.Sprintf(", failed to abort upload %s: %v", e.UploadID, e.AbortErr)
+	}
+	return msg
+}
+
+func (e *UploadTimeoutError) Unwrap() []error {
+	return []error{ErrUploadTimeout, e.Err}
+}
+
+// WithDeadline aborts the upload if it isn't finished by t, removing the
+// parts uploaded so far.
+func WithDeadline(t time.Time) SaveOption {
+	return func(o *SaveOptions) {
+		o.Deadline = t
+	}
+}
+
+// WithMaxDuration aborts the upload if Save takes longer than d, see WithDeadline.
+func WithMaxDuration(d time.Duration) SaveOption {
+	return func(o *SaveOptions) {
+		o.MaxDuration = d
+	}
+}
+
+// deadlineReader counts the bytes read and stops a slow body once the
+// deadline has passed, since the uploader doesn't check the context
+// between reads.
+type deadlineReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   int64
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if err := d.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	return n, err
+}
+
+// abortUpload removes the parts of a failed multipart upload. It runs
+// detached from ctx, which is usually done by now.
+func (s *S3Storage) abortUpload(ctx context.Context, path, uploadID string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+	_, err := s.client().AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(path),
+		UploadId: aws.String(uploadID),
+	}, s.optFns(opWrite)...)
+	return err
+}
+
+// cleanupUpload aborts the multipart upload behind a failed Save made with
+// a deadline and turns deadline errors into an UploadTimeoutError. Other
+// errors are returned as is.
+func (s *S3Storage) cleanupUpload(ctx context.Context, path string, err error, bytes int64) error {
+	var uploadID string
+	var abortErr error
+	var mf manager.MultiUploadFailure
+	if errors.As(err, &mf) && mf.UploadID() != "" {
+		uploadID = mf.UploadID()
+		abortErr = s.abortUpload(ctx, path, uploadID)
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &UploadTimeoutError{Path: path, Bytes: bytes, UploadID: uploadID, AbortErr: abortErr, Err: err}
+}
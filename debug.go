@@ -0,0 +1,90 @@
+package s3storage
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// redactedHeaders and redactedQuery carry credentials and are never logged.
+var (
+	redactedHeaders = []string{
+		"Authorization",
+		"X-Amz-Security-Token",
+		"X-Amz-Server-Side-Encryption-Customer-Key",
+		"X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key",
+	}
+	redactedQuery = []string{
+		"X-Amz-Signature",
+		"X-Amz-Credential",
+		"X-Amz-Security-Token",
+	}
+)
+
+type debugHTTPKey struct{}
+
+// WithDebugHTTP turns on request logging for the S3 calls made with ctx,
+// as Config.DebugHTTP does for all calls.
+func WithDebugHTTP(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugHTTPKey{}, true)
+}
+
+// debugHTTPClient logs sanitized request and response headers and the
+// duration of every attempt. Records are logged at info level: the output
+// was asked for explicitly, and slog's default handler drops debug records.
+type debugHTTPClient struct {
+	always bool
+	logger *slog.Logger
+	next   aws.HTTPClient
+}
+
+func (c *debugHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if on, _ := req.Context().Value(debugHTTPKey{}).(bool); !on && !c.always {
+		return c.next.Do(req)
+	}
+
+	start := time.Now()
+	resp, err := c.next.Do(req)
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", sanitizeURL(req.URL)),
+		slog.Any("request_headers", sanitizeHeaders(req.Header)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		c.logger.LogAttrs(req.Context(), slog.LevelInfo, "s3 request failed", append(attrs, slog.Any("error", err))...)
+		return resp, err
+	}
+	attrs = append(attrs,
+		slog.Int("status", resp.StatusCode),
+		slog.Any("response_headers", sanitizeHeaders(resp.Header)),
+	)
+	c.logger.LogAttrs(req.Context(), slog.LevelInfo, "s3 request", attrs...)
+	return resp, err
+}
+
+func sanitizeHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, "REDACTED")
+		}
+	}
+	return h
+}
+
+func sanitizeURL(u *url.URL) string {
+	q := u.Query()
+	for _, name := range redactedQuery {
+		if q.Has(name) {
+			q.Set(name, "REDACTED")
+		}
+	}
+	clean := *u
+	clean.RawQuery = q.Encode()
+	return clean.String()
+}
@@ -0,0 +1,154 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrEgressQuotaExceeded = errors.New("egress quota exceeded")
+
+type tenantKey struct{}
+
+// WithTenant attributes reads made with ctx to tenant for egress accounting.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// EgressBudget limits bytes served per time window. Zero limits are unlimited.
+type EgressBudget struct {
+	Window    time.Duration
+	PerKey    int64
+	PerTenant int64
+	Total     int64
+}
+
+// EgressLimiter wraps a Storage and counts bytes served by Open and
+// Download. Once a key, the tenant from the context or the whole storage
+// has used up its budget for the current window, reads fail with
+// ErrEgressQuotaExceeded. A read that starts within budget is allowed to
+// finish, so budgets can be overshot by one object.
+type EgressLimiter struct {
+	Storage
+	budget EgressBudget
+
+	mu          sync.Mutex
+	windowStart time.Time
+	byKey       map[string]int64
+	byTenant    map[string]int64
+	total       int64
+}
+
+// NewEgressLimiter creates an EgressLimiter around next.
+func NewEgressLimiter(next Storage, budget EgressBudget) *EgressLimiter {
+	if budget.Window == 0 {
+		budget.Window = 24 * time.Hour
+	}
+	return &EgressLimiter{
+		Storage:     next,
+		budget:      budget,
+		windowStart: time.Now(),
+		byKey:       make(map[string]int64),
+		byTenant:    make(map[string]int64),
+	}
+}
+
+func (l *EgressLimiter) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	tenant := tenantFromContext(ctx)
+	if err := l.check(path, tenant); err != nil {
+		return nil, err
+	}
+	rc, err := l.Storage.Open(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReadCloser{ReadCloser: rc, count: func(n int64) { l.add(path, tenant, n) }}, nil
+}
+
+func (l *EgressLimiter) Download(ctx context.Context, path string, w io.WriterAt) error {
+	tenant := tenantFromContext(ctx)
+	if err := l.check(path, tenant); err != nil {
+		return err
+	}
+	return l.Storage.Download(ctx, path, &countingWriterAt{WriterAt: w, count: func(n int64) { l.add(path, tenant, n) }})
+}
+
+// Usage returns the bytes served in the current window for a key and a tenant.
+func (l *EgressLimiter) Usage(path, tenant string) (perKey, perTenant int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotate()
+	return l.byKey[path], l.byTenant[tenant]
+}
+
+func (l *EgressLimiter) check(path, tenant string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotate()
+
+	if l.budget.Total > 0 && l.total >= l.budget.Total {
+		return ErrEgressQuotaExceeded
+	}
+	if l.budget.PerKey > 0 && l.byKey[path] >= l.budget.PerKey {
+		return ErrEgressQuotaExceeded
+	}
+	if tenant != "" && l.budget.PerTenant > 0 && l.byTenant[tenant] >= l.budget.PerTenant {
+		return ErrEgressQuotaExceeded
+	}
+	return nil
+}
+
+func (l *EgressLimiter) add(path, tenant string, n int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotate()
+	l.total += n
+	l.byKey[path] += n
+	if tenant != "" {
+		l.byTenant[tenant] += n
+	}
+}
+
+// rotate starts a new window if the current one is over. l.mu must be held.
+func (l *EgressLimiter) rotate() {
+	if time.Since(l.windowStart) < l.budget.Window {
+		return
+	}
+	l.windowStart = time.Now()
+	l.byKey = make(map[string]int64)
+	l.byTenant = make(map[string]int64)
+	l.total = 0
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	count func(int64)
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.count(int64(n))
+	}
+	return n, err
+}
+
+type countingWriterAt struct {
+	io.WriterAt
+	count func(int64)
+}
+
+func (c *countingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := c.WriterAt.WriteAt(p, off)
+	if n > 0 {
+		c.count(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,105 @@
+package s3storage
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+)
+
+// endpointCooldown is how long an endpoint is skipped after a connection failure.
+const endpointCooldown = 30 * time.Second
+
+// endpointPool spreads requests over several equivalent endpoints
+// round-robin and skips the ones that recently failed to connect.
+// The SDK resolves the endpoint on every attempt, so a retry after a
+// connection error goes to the next healthy endpoint.
+type endpointPool struct {
+	endpoints []*poolEndpoint
+	next      atomic.Uint64
+}
+
+type poolEndpoint struct {
+	url  string
+	host string
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func newEndpointPool(urls []string) (*endpointPool, error) {
+	p := &endpointPool{}
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.endpoints = append(p.endpoints, &poolEndpoint{url: raw, host: u.Host})
+	}
+	return p, nil
+}
+
+// pick returns the next healthy endpoint, or the next one at all if every
+// endpoint is down.
+func (p *endpointPool) pick() string {
+	n := uint64(len(p.endpoints))
+	start := p.next.Add(1)
+	now := time.Now()
+	for i := uint64(0); i < n; i++ {
+		e := p.endpoints[(start+i)%n]
+		if e.healthy(now) {
+			return e.url
+		}
+	}
+	return p.endpoints[start%n].url
+}
+
+// markDown takes the endpoint serving host out of rotation for a while.
+func (p *endpointPool) markDown(host string) {
+	for _, e := range p.endpoints {
+		if host == e.host || strings.HasSuffix(host, "."+e.host) {
+			e.mu.Lock()
+			e.downUntil = time.Now().Add(endpointCooldown)
+			e.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (e *poolEndpoint) healthy(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.After(e.downUntil)
+}
+
+// poolResolver resolves every request against an endpoint from the pool.
+type poolResolver struct {
+	pool *endpointPool
+	next s3.EndpointResolverV2
+}
+
+func (r *poolResolver) ResolveEndpoint(ctx context.Context, params s3.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	params.Endpoint = aws.String(r.pool.pick())
+	return r.next.ResolveEndpoint(ctx, params)
+}
+
+// poolHTTPClient reports connection failures back to the pool.
+type poolHTTPClient struct {
+	pool *endpointPool
+	next aws.HTTPClient
+}
+
+func (c *poolHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	if err != nil && req.Context().Err() == nil {
+		c.pool.markDown(req.URL.Host)
+	}
+	return resp, err
+}
@@ -0,0 +1,187 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// ErrorCode classifies storage failures independently of the backend, so
+// callers can react to them, e.g. pick an HTTP status, without matching
+// error strings.
+type ErrorCode int
+
+const (
+	CodeUnknown ErrorCode = iota
+	CodeNotFound
+	CodeAccessDenied
+	CodeThrottled
+	CodeTimeout
+	CodeCanceled
+	CodeConflict
+	CodePreconditionFailed
+	CodeTooLarge
+	CodeInvalidKey
+)
+
+var errorCodeNames = [...]string{
+	CodeUnknown:            "unknown",
+	CodeNotFound:           "not found",
+	CodeAccessDenied:       "access denied",
+	CodeThrottled:          "throttled",
+	CodeTimeout:            "timeout",
+	CodeCanceled:           "canceled",
+	CodeConflict:           "conflict",
+	CodePreconditionFailed: "precondition failed",
+	CodeTooLarge:           "too large",
+	CodeInvalidKey:         "invalid key",
+}
+
+func (c ErrorCode) String() string {
+	if c < 0 || int(c) >= len(errorCodeNames) {
+		return fmt.Sprintf("ErrorCode(%d)", int(c))
+	}
+	return errorCodeNames[c]
+}
+
+// HTTPStatus returns the status code a server would usually answer with
+// for failures of this kind.
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAccessDenied:
+		return http.StatusForbidden
+	case CodeThrottled:
+		return http.StatusTooManyRequests
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	case CodeCanceled:
+		// Nginx's "client closed request", there is no standard code.
+		return 499
+	case CodeConflict:
+		return http.StatusConflict
+	case CodePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeInvalidKey:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// StorageError is returned by the operations of S3Storage that talk to S3,
+// and by CloudFrontInvalidator with the distribution ID as Bucket.
+// Missing objects are still reported as ErrNotFound itself, not wrapped, so
+// callers comparing errors with == keep working.
+type StorageError struct {
+	Op     string
+	Bucket string
+	Key    string
+	Code   ErrorCode
+	Err    error
+}
+
+func (e *StorageError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s %s: %v", e.Op, e.Bucket, e.Err)
+	}
+	return fmt.Sprintf("%s %s/%s: %v", e.Op, e.Bucket, e.Key, e.Err)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the code of err. Errors other than StorageError are
+// classified by their cause, so it works for all errors of this package.
+func ErrorCodeOf(err error) ErrorCode {
+	var se *StorageError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return classifyError(err)
+}
+
+// storageError wraps a failure of an operation and counts it for Status.
+// ErrNotFound is returned as is.
+func (s *S3Storage) storageError(op, bucket, key string, err error) error {
+	code := classifyError(err)
+	s.stats.recordError(code)
+	if err == ErrNotFound {
+		return ErrNotFound
+	}
+	return &StorageError{Op: op, Bucket: bucket, Key: key, Code: code, Err: err}
+}
+
+func classifyError(err error) ErrorCode {
+	switch {
+	case err == nil:
+		return CodeUnknown
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrDirectoryMarker):
+		return CodeNotFound
+	case errors.Is(err, ErrPreconditionFailed):
+		return CodePreconditionFailed
+	case errors.Is(err, ErrUploadTimeout), errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, ErrEgressQuotaExceeded):
+		return CodeThrottled
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound", "NoSuchBucket", "NoSuchUpload":
+			return CodeNotFound
+		case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken":
+			return CodeAccessDenied
+		case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequests":
+			return CodeThrottled
+		case "RequestTimeout":
+			return CodeTimeout
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			// S3 answers 409 ConditionalRequestConflict when conditional
+			// writes race, isPreconditionFailed treats it the same way.
+			return CodePreconditionFailed
+		case "OperationAborted":
+			return CodeConflict
+		case "EntityTooLarge":
+			return CodeTooLarge
+		case "KeyTooLongError", "InvalidObjectName":
+			return CodeInvalidKey
+		}
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return CodeNotFound
+		case http.StatusForbidden:
+			return CodeAccessDenied
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return CodeThrottled
+		case http.StatusConflict:
+			return CodeConflict
+		case http.StatusPreconditionFailed:
+			return CodePreconditionFailed
+		case http.StatusRequestEntityTooLarge:
+			return CodeTooLarge
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CodeTimeout
+	}
+	return CodeUnknown
+}
@@ -0,0 +1,55 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	apiErr := func(code string) error {
+		return &smithy.GenericAPIError{Code: code}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{name: "not found", err: ErrNotFound, want: CodeNotFound},
+		{name: "directory marker", err: ErrDirectoryMarker, want: CodeNotFound},
+		{name: "wrapped precondition", err: fmt.Errorf("store: %w", ErrPreconditionFailed), want: CodePreconditionFailed},
+		{name: "canceled", err: context.Canceled, want: CodeCanceled},
+		{name: "deadline", err: context.DeadlineExceeded, want: CodeTimeout},
+		{name: "NoSuchKey", err: apiErr("NoSuchKey"), want: CodeNotFound},
+		{name: "SlowDown", err: apiErr("SlowDown"), want: CodeThrottled},
+		{name: "PreconditionFailed", err: apiErr("PreconditionFailed"), want: CodePreconditionFailed},
+		{name: "ConditionalRequestConflict", err: apiErr("ConditionalRequestConflict"), want: CodePreconditionFailed},
+		{name: "OperationAborted", err: apiErr("OperationAborted"), want: CodeConflict},
+		{name: "storage error", err: &StorageError{Code: CodeAccessDenied, Err: errors.New("denied")}, want: CodeAccessDenied},
+		{name: "other", err: errors.New("boom"), want: CodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCodeOf(tt.err); got != tt.want {
+				t.Errorf("ErrorCodeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreconditionClassificationAgrees(t *testing.T) {
+	for _, code := range []string{"PreconditionFailed", "ConditionalRequestConflict", "OperationAborted", "NoSuchKey"} {
+		err := &smithy.GenericAPIError{Code: code}
+		if isPreconditionFailed(err) != (classifyError(err) == CodePreconditionFailed) {
+			t.Errorf("%s: isPreconditionFailed and classifyError disagree", code)
+		}
+	}
+	if got := CodeNotFound.HTTPStatus(); got != http.StatusNotFound {
+		t.Errorf("CodeNotFound.HTTPStatus() = %d", got)
+	}
+}
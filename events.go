@@ -0,0 +1,119 @@
+package s3storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultPublishTimeout bounds each Publish call of an EventPublisher
+// without a Timeout.
+const DefaultPublishTimeout = 5 * time.Second
+
+// Publisher delivers change events to an external system.
+type Publisher interface {
+	Publish(ctx context.Context, event ChangeEvent) error
+}
+
+// EventPublisher wraps a Storage and passes every successful Save and
+// Delete to its publishers. Publishing happens synchronously after the
+// mutation, so events for one key are delivered in order. Each Publish
+// call is bounded by Timeout, so a stalled broker delays mutations by at
+// most that long per publisher. Publish errors don't fail the mutation,
+// they are reported to OnError.
+type EventPublisher struct {
+	Storage
+	Publishers []Publisher
+	OnError    func(event ChangeEvent, err error)
+	// Timeout bounds each Publish call, DefaultPublishTimeout if zero.
+	Timeout time.Duration
+}
+
+// NewEventPublisher creates an EventPublisher around next.
+func NewEventPublisher(next Storage, publishers ...Publisher) *EventPublisher {
+	return &EventPublisher{Storage: next, Publishers: publishers}
+}
+
+// Save uploads a file and publishes an event on success.
+func (p *EventPublisher) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	if err := p.Storage.Save(ctx, path, r, opts...); err != nil {
+		return err
+	}
+	p.publish(ctx, ChangeEvent{Type: EventSave, Key: path, Time: time.Now().UTC()})
+	return nil
+}
+
+// Delete removes a file and publishes an event on success.
+func (p *EventPublisher) Delete(ctx context.Context, path string) error {
+	if err := p.Storage.Delete(ctx, path); err != nil {
+		return err
+	}
+	p.publish(ctx, ChangeEvent{Type: EventDelete, Key: path, Time: time.Now().UTC()})
+	return nil
+}
+
+func (p *EventPublisher) publish(ctx context.Context, event ChangeEvent) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPublishTimeout
+	}
+	// The mutation is done, publish it even if the caller gives up.
+	ctx = context.WithoutCancel(ctx)
+	for _, pub := range p.Publishers {
+		pubCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := pub.Publish(pubCtx, event)
+		cancel()
+		if err != nil && p.OnError != nil {
+			p.OnError(event, err)
+		}
+	}
+}
+
+// NATSConn is the subset of *nats.Conn used by NATSPublisher.
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSPublisher publishes events as JSON to a NATS subject.
+type NATSPublisher struct {
+	Conn    NATSConn
+	Subject string
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event ChangeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := p.Conn.Publish(p.Subject, data); err != nil {
+		return fmt.Errorf("failed to publish to nats subject %s: %w", p.Subject, err)
+	}
+	return nil
+}
+
+// KafkaProducer is a minimal adapter over a Kafka client, e.g. a
+// kafka-go Writer or a sarama SyncProducer.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// KafkaPublisher publishes events as JSON to a Kafka topic. The object key
+// is used as the message key, so events for one object land in the same
+// partition.
+type KafkaPublisher struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, event ChangeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := p.Producer.Produce(ctx, p.Topic, []byte(event.Key), data); err != nil {
+		return fmt.Errorf("failed to publish to kafka topic %s: %w", p.Topic, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package s3storage
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportFormat is the output format of ExportListing.
+type ExportFormat int
+
+const (
+	// FormatCSV writes a header line and one key,size,etag,last_modified
+	// row per object.
+	FormatCSV ExportFormat = iota
+	// FormatJSONL writes one JSON object per line.
+	FormatJSONL
+)
+
+type ExportOptions struct {
+	// StartAfter resumes an export after this key, as returned by an
+	// interrupted ExportListing.
+	StartAfter string
+}
+
+type ExportOption func(*ExportOptions)
+
+// WithStartAfter resumes an export after key. The CSV header is not
+// written again.
+func WithStartAfter(key string) ExportOption {
+	return func(o *ExportOptions) {
+		o.StartAfter = key
+	}
+}
+
+type exportRecord struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// ExportListing streams the listing of prefix to w page by page, so it
+// works for buckets with millions of objects without holding them in
+// memory. It returns the last key written; if the export fails midway,
+// pass it to WithStartAfter to continue where it stopped. The cursor moves
+// a page at a time, so some rows of the failed page may be written twice.
+func (s *S3Storage) ExportListing(ctx context.Context, prefix string, w io.Writer, format ExportFormat, opts ...ExportOption) (string, error) {
+	options := ExportOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var (
+		csvw *csv.Writer
+		enc  *json.Encoder
+	)
+	switch format {
+	case FormatCSV:
+		csvw = csv.NewWriter(w)
+		if options.StartAfter == "" {
+			csvw.Write([]string{"key", "size", "etag", "last_modified"})
+		}
+	case FormatJSONL:
+		enc = json.NewEncoder(w)
+	default:
+		return "", fmt.Errorf("unknown export format %d", format)
+	}
+
+	// Pages are listed with StartAfter rather than continuation tokens,
+	// so that a page can be retried on the write endpoint.
+	last := options.StartAfter
+	for {
+		objects, next, err := s.ListPage(ctx, prefix, last, 1000)
+		if err != nil {
+			return last, err
+		}
+
+		for _, obj := range objects {
+			rec := exportRecord{
+				Key:          obj.Key,
+				Size:         obj.Size,
+				ETag:         obj.ETag,
+				LastModified: obj.LastModified.UTC(),
+			}
+			if csvw != nil {
+				err = csvw.Write([]string{rec.Key, strconv.FormatInt(rec.Size, 10), rec.ETag, rec.LastModified.Format(time.RFC3339)})
+			} else {
+				err = enc.Encode(rec)
+			}
+			if err != nil {
+				return last, fmt.Errorf("failed to write listing: %w", err)
+			}
+		}
+
+		// Only advance the cursor once the whole page is out.
+		if csvw != nil {
+			csvw.Flush()
+			if err := csvw.Error(); err != nil {
+				return last, fmt.Errorf("failed to write listing: %w", err)
+			}
+		}
+		if next == "" {
+			if n := len(objects); n > 0 {
+				last = objects[n-1].Key
+			}
+			break
+		}
+		last = next
+	}
+	return last, nil
+}
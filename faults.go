@@ -0,0 +1,161 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrInjectedFailure is returned by requests failed by a FaultInjector.
+var ErrInjectedFailure = errors.New("injected failure")
+
+// FaultConfig selects the uploads a FaultInjector fails.
+type FaultConfig struct {
+	// FailParts lists UploadPart part numbers that fail.
+	FailParts []int32
+	// FailAfterBytes fails the first PutObject or UploadPart that would
+	// take the bytes uploaded through the injector past this amount, and
+	// all following ones. 0 disables it.
+	FailAfterBytes int64
+	// Times is how often each fault fires before requests succeed again,
+	// to test retries. 0 means always.
+	Times int
+	// Err is the error to fail with, ErrInjectedFailure if nil.
+	Err error
+}
+
+// FaultInjector fails chosen upload requests before they are sent, so
+// tests of code built on this package can exercise cleanup and retries of
+// partial uploads deterministically. Add APIOption to the APIOptions of the
+// S3 client:
+//
+//	faults := s3storage.NewFaultInjector(s3storage.FaultConfig{FailParts: []int32{3}})
+//	opts.APIOptions = append(opts.APIOptions, faults.APIOption())
+type FaultInjector struct {
+	cfg FaultConfig
+
+	mu        sync.Mutex
+	uploaded  int64
+	partFired map[int32]int
+	sizeFired int
+}
+
+func NewFaultInjector(cfg FaultConfig) *FaultInjector {
+	if cfg.Err == nil {
+		cfg.Err = ErrInjectedFailure
+	}
+	return &FaultInjector{cfg: cfg, partFired: make(map[int32]int)}
+}
+
+// Uploaded returns the body bytes of the upload requests let through.
+func (f *FaultInjector) Uploaded() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploaded
+}
+
+// APIOption returns the middleware to add to the client's APIOptions.
+func (f *FaultInjector) APIOption() func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("FaultInjector",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if err := f.check(in.Parameters); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				return next.HandleInitialize(ctx, in)
+			}), middleware.Before)
+	}
+}
+
+// check decides whether the request with input params fails.
+func (f *FaultInjector) check(params any) error {
+	var (
+		part   int32
+		size   int64
+		isPart bool
+	)
+	switch in := params.(type) {
+	case *s3.UploadPartInput:
+		part, isPart = aws.ToInt32(in.PartNumber), true
+		size = bodySize(in.Body, in.ContentLength)
+	case *s3.PutObjectInput:
+		size = bodySize(in.Body, in.ContentLength)
+	default:
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if isPart && slices.Contains(f.cfg.FailParts, part) && f.fire(f.partFired[part]) {
+		f.partFired[part]++
+		return f.cfg.Err
+	}
+	if f.cfg.FailAfterBytes > 0 && f.uploaded+size > f.cfg.FailAfterBytes && f.fire(f.sizeFired) {
+		f.sizeFired++
+		return f.cfg.Err
+	}
+	f.uploaded += size
+	return nil
+}
+
+func (f *FaultInjector) fire(fired int) bool {
+	return f.cfg.Times == 0 || fired < f.cfg.Times
+}
+
+// bodySize returns the length of a request body, or 0 if it can't be told
+// without reading it.
+func bodySize(body io.Reader, contentLength *int64) int64 {
+	if contentLength != nil {
+		return *contentLength
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return 0
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0
+	}
+	if _, err := seeker.Seek(pos, io.SeekStart); err != nil {
+		return 0
+	}
+	return end - pos
+}
+
+// FailingReader returns a reader reading from r that fails with err after n
+// bytes, ErrInjectedFailure if err is nil. It simulates a body source, like
+// a pipe or a network stream, breaking in the middle of an upload.
+func FailingReader(r io.Reader, n int64, err error) io.Reader {
+	if err == nil {
+		err = ErrInjectedFailure
+	}
+	return &failingReader{r: r, left: n, err: err}
+}
+
+type failingReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.left <= 0 {
+		return 0, r.err
+	}
+	if int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,160 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// multipartServer is a minimal S3 endpoint for multipart uploads that
+// records the parts it received and whether the upload was aborted.
+type multipartServer struct {
+	mu        sync.Mutex
+	parts     []string
+	completed bool
+	aborted   bool
+}
+
+func (m *multipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Get("uploadId") == "upload":
+		io.Copy(io.Discard, r.Body)
+		m.parts = append(m.parts, q.Get("partNumber"))
+		w.Header().Set("ETag", `"part`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Get("uploadId") == "upload":
+		m.completed = true
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>key</Key><ETag>"done"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Get("uploadId") == "upload":
+		m.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestFaultInjectorAbortsMultipartUpload(t *testing.T) {
+	srv := &multipartServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	faults := NewFaultInjector(FaultConfig{FailParts: []int32{3}})
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(ts.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		APIOptions:   []func(*middleware.Stack) error{faults.APIOption()},
+	})
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = manager.MinUploadPartSize
+		u.Concurrency = 1
+	})
+
+	body := bytes.NewReader(make([]byte, 4*manager.MinUploadPartSize))
+	_, err := uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("key"),
+		Body:   body,
+	})
+	if !errors.Is(err, ErrInjectedFailure) {
+		t.Fatalf("Upload error = %v, want ErrInjectedFailure", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if !srv.aborted {
+		t.Error("multipart upload was not aborted")
+	}
+	if srv.completed {
+		t.Error("multipart upload was completed")
+	}
+	for _, part := range srv.parts {
+		if part == "3" {
+			t.Error("part 3 reached the server")
+		}
+	}
+	if got, want := faults.Uploaded(), int64(2*manager.MinUploadPartSize); got != want {
+		t.Errorf("Uploaded() = %d, want %d", got, want)
+	}
+}
+
+func TestFaultInjectorCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    FaultConfig
+		inputs []any
+		fail   []bool
+	}{
+		{
+			name: "failing part",
+			cfg:  FaultConfig{FailParts: []int32{2}},
+			inputs: []any{
+				&s3.UploadPartInput{PartNumber: aws.Int32(1), ContentLength: aws.Int64(5)},
+				&s3.UploadPartInput{PartNumber: aws.Int32(2), ContentLength: aws.Int64(5)},
+				&s3.UploadPartInput{PartNumber: aws.Int32(2), ContentLength: aws.Int64(5)},
+			},
+			fail: []bool{false, true, true},
+		},
+		{
+			name: "failing part once",
+			cfg:  FaultConfig{FailParts: []int32{2}, Times: 1},
+			inputs: []any{
+				&s3.UploadPartInput{PartNumber: aws.Int32(2), ContentLength: aws.Int64(5)},
+				&s3.UploadPartInput{PartNumber: aws.Int32(2), ContentLength: aws.Int64(5)},
+			},
+			fail: []bool{true, false},
+		},
+		{
+			name: "byte budget",
+			cfg:  FaultConfig{FailAfterBytes: 10},
+			inputs: []any{
+				&s3.PutObjectInput{Body: bytes.NewReader(make([]byte, 8))},
+				&s3.PutObjectInput{Body: bytes.NewReader(make([]byte, 8))},
+				&s3.PutObjectInput{Body: bytes.NewReader(make([]byte, 2))},
+			},
+			fail: []bool{false, true, false},
+		},
+		{
+			name:   "other requests",
+			cfg:    FaultConfig{FailAfterBytes: 1},
+			inputs: []any{&s3.GetObjectInput{}, &s3.HeadObjectInput{}},
+			fail:   []bool{false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFaultInjector(tt.cfg)
+			for i, in := range tt.inputs {
+				err := f.check(in)
+				if (err != nil) != tt.fail[i] {
+					t.Errorf("request %d: check() = %v, want failure %v", i, err, tt.fail[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFailingReader(t *testing.T) {
+	r := FailingReader(bytes.NewReader(make([]byte, 100)), 50, nil)
+	n, err := io.Copy(io.Discard, r)
+	if n != 50 || !errors.Is(err, ErrInjectedFailure) {
+		t.Fatalf("io.Copy = %d, %v; want 50, ErrInjectedFailure", n, err)
+	}
+}
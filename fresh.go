@@ -0,0 +1,91 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// flight is a refresh in progress that concurrent callers wait on.
+type flight struct {
+	done chan struct{}
+	err  error
+}
+
+// EnsureFresh makes sure the object at path is younger than maxAge. If it is
+// missing or stale, refresh is called to write new content, which is
+// uploaded in place. Concurrent calls for the same path within one
+// S3Storage share a single refresh. The refresh isn't tied to the caller
+// that started it: it goes on when that caller's ctx is canceled, while
+// each caller stops waiting when its own ctx is done.
+func (s *S3Storage) EnsureFresh(ctx context.Context, path string, maxAge time.Duration, refresh func(io.Writer) error) error {
+	fresh, err := s.isFresh(ctx, path, maxAge)
+	if err != nil || fresh {
+		return err
+	}
+
+	detached := context.WithoutCancel(ctx)
+	return s.singleflight(ctx, path, func() error {
+		// A refresh that finished just before this flight started may
+		// have made the object fresh already.
+		fresh, err := s.isFresh(detached, path, maxAge)
+		if err != nil || fresh {
+			return err
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(refresh(pw))
+		}()
+		defer pr.Close()
+		return s.Save(detached, path, pr)
+	})
+}
+
+// isFresh reports whether path exists and is younger than maxAge.
+func (s *S3Storage) isFresh(ctx context.Context, path string, maxAge time.Duration) (bool, error) {
+	info, err := s.statForWrite(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return time.Since(info.LastModified) < maxAge, nil
+}
+
+// singleflight runs fn in the background unless a call for the same key is
+// already running, and waits for the result or for ctx to be done.
+func (s *S3Storage) singleflight(ctx context.Context, key string, fn func() error) error {
+	s.flightMu.Lock()
+	if f, ok := s.flights[key]; ok {
+		s.flightMu.Unlock()
+		return f.wait(ctx)
+	}
+	if s.flights == nil {
+		s.flights = make(map[string]*flight)
+	}
+	f := &flight{done: make(chan struct{})}
+	s.flights[key] = f
+	s.flightMu.Unlock()
+
+	go func() {
+		f.err = fn()
+
+		s.flightMu.Lock()
+		delete(s.flights, key)
+		s.flightMu.Unlock()
+		close(f.done)
+	}()
+	return f.wait(ctx)
+}
+
+func (f *flight) wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
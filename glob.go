@@ -0,0 +1,62 @@
+package s3storage
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// Glob returns objects whose keys match pattern. Besides the path.Match
+// syntax within a key segment, "**" as a whole segment matches any number
+// of segments, so "logs/**/*.gz" finds gzipped files at any depth. Only the
+// part of the pattern before the first wildcard is used as the listing
+// prefix, keep it as long as possible. Directory markers are skipped.
+func (s *S3Storage) Glob(ctx context.Context, pattern string) ([]ObjectInfo, error) {
+	segments := strings.Split(pattern, "/")
+	for _, seg := range segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := pattern
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		prefix = pattern[:i]
+	}
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []ObjectInfo
+	for _, obj := range objects {
+		if IsDirectoryMarker(obj) {
+			continue
+		}
+		if globMatch(segments, strings.Split(obj.Key, "/")) {
+			matched = append(matched, obj)
+		}
+	}
+	return matched, nil
+}
+
+func globMatch(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(key); i++ {
+				if globMatch(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(key) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], key[0]); !ok {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
@@ -0,0 +1,43 @@
+package s3storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{pattern: "logs/*.gz", key: "logs/a.gz", want: true},
+		{pattern: "logs/*.gz", key: "logs/2024/a.gz", want: false},
+		{pattern: "logs/*.gz", key: "logs/a.gz.tmp", want: false},
+		{pattern: "logs/?.gz", key: "logs/a.gz", want: true},
+		{pattern: "logs/?.gz", key: "logs/ab.gz", want: false},
+		{pattern: "logs/[ab].gz", key: "logs/b.gz", want: true},
+		{pattern: "logs/[ab].gz", key: "logs/c.gz", want: false},
+		{pattern: "logs/**/*.gz", key: "logs/a.gz", want: true},
+		{pattern: "logs/**/*.gz", key: "logs/2024/05/a.gz", want: true},
+		{pattern: "logs/**/*.gz", key: "other/2024/a.gz", want: false},
+		{pattern: "logs/**", key: "logs/2024/05/a.gz", want: true},
+		{pattern: "logs/**", key: "logs", want: true},
+		{pattern: "**/a.gz", key: "a.gz", want: true},
+		{pattern: "**/a.gz", key: "x/y/a.gz", want: true},
+		{pattern: "a/**/b/*", key: "a/x/b/y/b/c", want: true},
+		{pattern: "a/**/b/*", key: "a/x/b", want: false},
+		{pattern: "a/**b/*", key: "a/xb/c", want: true},
+		{pattern: "a/**b/*", key: "a/x/b/c", want: false},
+		{pattern: "dir/*", key: "dir/", want: true},
+		{pattern: "dir/*", key: "dir", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.key, func(t *testing.T) {
+			got := globMatch(strings.Split(tt.pattern, "/"), strings.Split(tt.key, "/"))
+			if got != tt.want {
+				t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+			}
+		})
+	}
+}
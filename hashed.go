@@ -0,0 +1,95 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// hashSpoolMemory is how much of a body SaveHashed keeps in memory while
+// hashing it, larger bodies go to a temporary file.
+const hashSpoolMemory = 8 << 20
+
+// HashNamer returns the key to store an asset under, given its logical key
+// and the SHA-256 of its content.
+type HashNamer func(key string, sum []byte) string
+
+// DefaultHashNamer inserts the first 8 hex digits of the hash before the
+// last extension, "js/app.min.js" becomes "js/app.min.3f2a91c0.js".
+func DefaultHashNamer(key string, sum []byte) string {
+	h := hex.EncodeToString(sum)[:8]
+	ext := path.Ext(key)
+	if ext == "" || strings.HasSuffix(key, "/"+ext) || key == ext {
+		return key + "." + h
+	}
+	return strings.TrimSuffix(key, ext) + "." + h + ext
+}
+
+// AssetManifest maps logical asset keys to their content-hashed keys.
+type AssetManifest map[string]string
+
+// SaveHashed stores r under a key derived from its content, so the key
+// changes whenever the content does and CDNs and browsers can cache it
+// forever. namer builds the key, DefaultHashNamer if nil. Content already
+// stored under that key is not uploaded again. Returns the hashed key;
+// collect them in an AssetManifest to look them up by logical name.
+func (s *S3Storage) SaveHashed(ctx context.Context, key string, r io.Reader, namer HashNamer, opts ...SaveOption) (string, error) {
+	if namer == nil {
+		namer = DefaultHashNamer
+	}
+
+	sp, err := spool(r, hashSpoolMemory, "")
+	if err != nil {
+		return "", err
+	}
+	defer sp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, sp); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", key, err)
+	}
+	if _, err := sp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", key, err)
+	}
+
+	hashed := namer(key, h.Sum(nil))
+	_, err = s.statForWrite(ctx, hashed)
+	if errors.Is(err, ErrNotFound) {
+		err = s.Save(ctx, hashed, sp, opts...)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hashed, nil
+}
+
+// SaveManifest stores m as JSON at path.
+func (s *S3Storage) SaveManifest(ctx context.Context, path string, m AssetManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	return s.Save(ctx, path, bytes.NewReader(data), WithContentType("application/json"), WithTransforms())
+}
+
+// LoadManifest reads a manifest stored by SaveManifest.
+func (s *S3Storage) LoadManifest(ctx context.Context, path string) (AssetManifest, error) {
+	rc, err := s.OpenTransformed(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var m AssetManifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,30 @@
+package s3storage
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestDefaultHashNamer(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	const h = "ed7002b4"
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "app.js", want: "app." + h + ".js"},
+		{key: "js/app.min.js", want: "js/app.min." + h + ".js"},
+		{key: "fonts/LICENSE", want: "fonts/LICENSE." + h},
+		{key: "static/.htaccess", want: "static/.htaccess." + h},
+		{key: ".env", want: ".env." + h},
+		{key: "v1.2/readme", want: "v1.2/readme." + h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := DefaultHashNamer(tt.key, sum[:]); got != tt.want {
+				t.Errorf("DefaultHashNamer(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
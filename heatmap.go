@@ -0,0 +1,170 @@
+package s3storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// heatmapSlots is the number of slots the window is split into. Counts
+// expire a slot at a time.
+const heatmapSlots = 60
+
+// minHeatmapWindow keeps slots at least a second long.
+const minHeatmapWindow = heatmapSlots * time.Second
+
+type HeatmapConfig struct {
+	// Window is how far back counts are kept, an hour by default. Windows
+	// shorter than a minute are rounded up to one.
+	Window time.Duration
+	// Depth is the number of key segments counts are grouped by, e.g. with
+	// depth 2 "users/42/avatar.png" counts towards "users/42/". Zero
+	// counts every key separately.
+	Depth int
+}
+
+// HeatmapRecorder wraps a Storage and counts reads and writes per key
+// prefix in memory, to find hot keys worth caching or sharding.
+type HeatmapRecorder struct {
+	Storage
+	cfg      HeatmapConfig
+	slotSize time.Duration
+
+	mu    sync.Mutex
+	slots [heatmapSlots]heatmapSlot
+}
+
+type heatmapSlot struct {
+	start  time.Time
+	counts map[string]*heatCount
+}
+
+type heatCount struct {
+	reads, writes int64
+}
+
+// NewHeatmapRecorder creates a HeatmapRecorder around next.
+func NewHeatmapRecorder(next Storage, cfg HeatmapConfig) *HeatmapRecorder {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+	cfg.Window = max(cfg.Window, minHeatmapWindow)
+	return &HeatmapRecorder{Storage: next, cfg: cfg, slotSize: cfg.Window / heatmapSlots}
+}
+
+func (h *HeatmapRecorder) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	err := h.Storage.Save(ctx, path, r, opts...)
+	if err == nil {
+		h.record(path, false)
+	}
+	return err
+}
+
+func (h *HeatmapRecorder) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := h.Storage.Open(ctx, path)
+	if err == nil {
+		h.record(path, true)
+	}
+	return rc, err
+}
+
+func (h *HeatmapRecorder) Download(ctx context.Context, path string, w io.WriterAt) error {
+	err := h.Storage.Download(ctx, path, w)
+	if err == nil {
+		h.record(path, true)
+	}
+	return err
+}
+
+func (h *HeatmapRecorder) record(path string, read bool) {
+	prefix := heatmapPrefix(path, h.cfg.Depth)
+	now := time.Now()
+	start := now.Truncate(h.slotSize)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	slot := &h.slots[start.UnixNano()/int64(h.slotSize)%heatmapSlots]
+	if !slot.start.Equal(start) {
+		slot.start = start
+		slot.counts = make(map[string]*heatCount)
+	}
+	c := slot.counts[prefix]
+	if c == nil {
+		c = &heatCount{}
+		slot.counts[prefix] = c
+	}
+	if read {
+		c.reads++
+	} else {
+		c.writes++
+	}
+}
+
+// DumpHeatmap writes the read and write counts per prefix within the
+// window as a table, busiest prefixes first.
+func (h *HeatmapRecorder) DumpHeatmap(ctx context.Context, w io.Writer) error {
+	cutoff := time.Now().Add(-h.cfg.Window)
+	totals := make(map[string]*heatCount)
+
+	h.mu.Lock()
+	for _, slot := range h.slots {
+		if slot.start.Before(cutoff) {
+			continue
+		}
+		for prefix, c := range slot.counts {
+			t := totals[prefix]
+			if t == nil {
+				t = &heatCount{}
+				totals[prefix] = t
+			}
+			t.reads += c.reads
+			t.writes += c.writes
+		}
+	}
+	h.mu.Unlock()
+
+	prefixes := make([]string, 0, len(totals))
+	for prefix := range totals {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		a, b := totals[prefixes[i]], totals[prefixes[j]]
+		if a.reads+a.writes != b.reads+b.writes {
+			return a.reads+a.writes > b.reads+b.writes
+		}
+		return prefixes[i] < prefixes[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PREFIX\tREADS\tWRITES\n")
+	for _, prefix := range prefixes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c := totals[prefix]
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", prefix, c.reads, c.writes)
+	}
+	return tw.Flush()
+}
+
+// heatmapPrefix returns the first depth segments of key including the
+// trailing slash, or the whole key.
+func heatmapPrefix(key string, depth int) string {
+	if depth <= 0 {
+		return key
+	}
+	i := 0
+	for n := 0; n < depth; n++ {
+		j := strings.IndexByte(key[i:], '/')
+		if j < 0 {
+			return key
+		}
+		i += j + 1
+	}
+	return key[:i]
+}
@@ -0,0 +1,18 @@
+package s3storage
+
+import "strings"
+
+// defaultInternalPrefix is where the package keeps its own records, like
+// shares and staged transactions, unless Config.InternalPrefix is set.
+const defaultInternalPrefix = ".s3storage/"
+
+// internalKey returns the key of an internal record.
+func (s *S3Storage) internalKey(name string) string {
+	return s.internalPrefix + name
+}
+
+// isHiddenKey reports whether key is an internal record that a listing of
+// prefix leaves out. Listings inside the internal prefix show them.
+func (s *S3Storage) isHiddenKey(prefix, key string) bool {
+	return !strings.HasPrefix(prefix, s.internalPrefix) && strings.HasPrefix(key, s.internalPrefix)
+}
@@ -0,0 +1,217 @@
+package s3storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// Invalidator purges paths from a CDN cache.
+type Invalidator interface {
+	Invalidate(ctx context.Context, paths []string) error
+}
+
+type InvalidationConfig struct {
+	Invalidator Invalidator
+	// Prefixes limits invalidation to keys under them, all keys if empty.
+	Prefixes []string
+	// Delay collects mutations for this long before invalidating them in
+	// one batch, so a deploy of many files costs few requests.
+	Delay time.Duration
+	// MaxBatch is the most paths sent in one request. A batch that fills
+	// up is sent without waiting for Delay.
+	MaxBatch int
+	// Path maps a key to the URL-escaped CDN path to invalidate, "/"+key
+	// with each segment escaped by default.
+	Path func(key string) string
+	// OnError is called when an invalidation request fails.
+	OnError func(paths []string, err error)
+}
+
+// InvalidatingStorage wraps a Storage and invalidates CDN paths after
+// successful Save and Delete calls. Invalidations are batched in the
+// background; call Close to send the pending ones.
+type InvalidatingStorage struct {
+	Storage
+	cfg InvalidationConfig
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	timer   *time.Timer
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewInvalidatingStorage creates an InvalidatingStorage around next.
+func NewInvalidatingStorage(next Storage, cfg InvalidationConfig) *InvalidatingStorage {
+	if cfg.Delay == 0 {
+		cfg.Delay = 5 * time.Second
+	}
+	if cfg.MaxBatch == 0 {
+		cfg.MaxBatch = 1000
+	}
+	if cfg.Path == nil {
+		cfg.Path = cdnPath
+	}
+	return &InvalidatingStorage{Storage: next, cfg: cfg, pending: make(map[string]struct{})}
+}
+
+// Save uploads a file and schedules its invalidation on success.
+func (s *InvalidatingStorage) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	if err := s.Storage.Save(ctx, path, r, opts...); err != nil {
+		return err
+	}
+	s.schedule(path)
+	return nil
+}
+
+// Delete removes a file and schedules its invalidation on success.
+func (s *InvalidatingStorage) Delete(ctx context.Context, path string) error {
+	if err := s.Storage.Delete(ctx, path); err != nil {
+		return err
+	}
+	s.schedule(path)
+	return nil
+}
+
+// Close sends pending invalidations and waits for all of them to finish.
+// Mutations after Close are invalidated synchronously.
+func (s *InvalidatingStorage) Close() error {
+	s.flush()
+	// Once closed, flush doesn't add to wg anymore, so Wait can't race
+	// with a timer firing.
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *InvalidatingStorage) schedule(key string) {
+	if !s.matches(key) {
+		return
+	}
+
+	s.mu.Lock()
+	s.pending[s.cfg.Path(key)] = struct{}{}
+	flushNow := len(s.pending) >= s.cfg.MaxBatch || s.closed
+	if !flushNow && s.timer == nil {
+		s.timer = time.AfterFunc(s.cfg.Delay, s.flush)
+	}
+	s.mu.Unlock()
+
+	if flushNow {
+		s.flush()
+	}
+}
+
+func (s *InvalidatingStorage) matches(key string) bool {
+	if len(s.cfg.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range s.cfg.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush sends the pending paths in batches of MaxBatch, in the background
+// until Close.
+func (s *InvalidatingStorage) flush() {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	paths := make([]string, 0, len(s.pending))
+	for p := range s.pending {
+		paths = append(paths, p)
+	}
+	s.pending = make(map[string]struct{})
+	background := !s.closed
+	if background {
+		s.wg.Add((len(paths) + s.cfg.MaxBatch - 1) / s.cfg.MaxBatch)
+	}
+	s.mu.Unlock()
+
+	sort.Strings(paths)
+	for len(paths) > 0 {
+		n := min(len(paths), s.cfg.MaxBatch)
+		batch := paths[:n]
+		paths = paths[n:]
+
+		if !background {
+			s.invalidate(batch)
+			continue
+		}
+		go func() {
+			defer s.wg.Done()
+			s.invalidate(batch)
+		}()
+	}
+}
+
+func (s *InvalidatingStorage) invalidate(paths []string) {
+	if err := s.cfg.Invalidator.Invalidate(context.Background(), paths); err != nil && s.cfg.OnError != nil {
+		s.cfg.OnError(paths, err)
+	}
+}
+
+// cdnPath returns the URL path of key, with each segment escaped.
+func cdnPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// CloudFrontInvalidator invalidates paths of a CloudFront distribution.
+type CloudFrontInvalidator struct {
+	Client         *cloudfront.Client
+	DistributionID string
+}
+
+// NewCloudFrontInvalidator creates a CloudFrontInvalidator using cfg.
+func NewCloudFrontInvalidator(cfg aws.Config, distributionID string) *CloudFrontInvalidator {
+	return &CloudFrontInvalidator{Client: cloudfront.NewFromConfig(cfg), DistributionID: distributionID}
+}
+
+func (c *CloudFrontInvalidator) Invalidate(ctx context.Context, paths []string) error {
+	ref := make([]byte, 8)
+	if _, err := rand.Read(ref); err != nil {
+		return fmt.Errorf("failed to generate caller reference: %w", err)
+	}
+	_, err := c.Client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(c.DistributionID),
+		InvalidationBatch: &cftypes.InvalidationBatch{
+			CallerReference: aws.String(time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(ref)),
+			Paths: &cftypes.Paths{
+				Quantity: aws.Int32(int32(len(paths))),
+				Items:    paths,
+			},
+		},
+	})
+	if err != nil {
+		return &StorageError{
+			Op:     "invalidate",
+			Bucket: c.DistributionID,
+			Code:   classifyError(err),
+			Err:    fmt.Errorf("%d paths: %w", len(paths), err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package s3storage
+
+import "testing"
+
+func TestCDNPath(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "img/logo.png", want: "/img/logo.png"},
+		{key: "docs/annual report.pdf", want: "/docs/annual%20report.pdf"},
+		{key: "a/b?c#d", want: "/a/b%3Fc%23d"},
+		{key: "100%/x", want: "/100%25/x"},
+		{key: "ü/é.txt", want: "/%C3%BC/%C3%A9.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := cdnPath(tt.key); got != tt.want {
+				t.Errorf("cdnPath(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
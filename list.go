@@ -0,0 +1,233 @@
+package s3storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// listShardConcurrency limits how many shards ListSharded lists at once.
+const listShardConcurrency = 16
+
+// ObjectInfo describes a stored object. ContentType and Metadata are
+// only filled by calls that read object headers, not by listings.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	ContentType  string
+	Metadata     map[string]string
+}
+
+// List returns all objects whose keys start with prefix.
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	bucket := s.readBucket(ctx)
+	objects, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) ([]ObjectInfo, error) {
+		var objects []ObjectInfo
+		paginator := s3.NewListObjectsV2Paginator(c, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx, s.readOptFns(ctx)...)
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range page.Contents {
+				if s.isHiddenKey(prefix, aws.ToString(obj.Key)) {
+					continue
+				}
+				objects = append(objects, ObjectInfo{
+					Key:          aws.ToString(obj.Key),
+					Size:         aws.ToInt64(obj.Size),
+					ETag:         aws.ToString(obj.ETag),
+					LastModified: aws.ToTime(obj.LastModified),
+				})
+			}
+		}
+		return objects, nil
+	})
+	if err != nil {
+		return nil, s.storageError("list", bucket, prefix, err)
+	}
+	return objects, nil
+}
+
+// PageLister is implemented by storages that can list in pages, like
+// S3Storage. Migration uses it to walk huge prefixes without holding the
+// whole listing in memory.
+type PageLister interface {
+	// ListPage returns up to limit objects under prefix with keys after
+	// startAfter, in key order. next is the startAfter of the following
+	// page, or empty after the last page.
+	ListPage(ctx context.Context, prefix, startAfter string, limit int) (objects []ObjectInfo, next string, err error)
+}
+
+var _ PageLister = (*S3Storage)(nil)
+
+// ListPage returns one page of the listing of prefix, see PageLister. S3
+// returns at most 1000 objects per page.
+func (s *S3Storage) ListPage(ctx context.Context, prefix, startAfter string, limit int) ([]ObjectInfo, string, error) {
+	bucket := s.readBucket(ctx)
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(int32(min(max(limit, 1), 1000))),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+	resp, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (*s3.ListObjectsV2Output, error) {
+		return c.ListObjectsV2(ctx, input, s.readOptFns(ctx)...)
+	})
+	if err != nil {
+		return nil, "", s.storageError("list", bucket, prefix, err)
+	}
+
+	objects := make([]ObjectInfo, 0, len(resp.Contents))
+	for _, obj := range resp.Contents {
+		if s.isHiddenKey(prefix, aws.ToString(obj.Key)) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			ETag:         aws.ToString(obj.ETag),
+			LastModified: aws.ToTime(obj.LastModified),
+		})
+	}
+	// The cursor is the last key S3 returned, hidden or not.
+	var next string
+	if aws.ToBool(resp.IsTruncated) && len(resp.Contents) > 0 {
+		next = aws.ToString(resp.Contents[len(resp.Contents)-1].Key)
+	}
+	return objects, next, nil
+}
+
+// PrefixExists reports whether any object key starts with prefix. It
+// lists a single key, so it is cheap even for huge prefixes.
+func (s *S3Storage) PrefixExists(ctx context.Context, prefix string) (bool, error) {
+	bucket := s.readBucket(ctx)
+	var startAfter *string
+	for {
+		resp, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (*s3.ListObjectsV2Output, error) {
+			return c.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+				Bucket:     aws.String(bucket),
+				Prefix:     aws.String(prefix),
+				StartAfter: startAfter,
+				MaxKeys:    aws.Int32(1),
+			}, s.readOptFns(ctx)...)
+		})
+		if err != nil {
+			return false, s.storageError("prefix exists", bucket, prefix, err)
+		}
+		if len(resp.Contents) == 0 {
+			return false, nil
+		}
+		key := aws.ToString(resp.Contents[0].Key)
+		if !s.isHiddenKey(prefix, key) {
+			return true, nil
+		}
+		// Skip the internal records with one request. Keys sorting after
+		// the jump target, if any, are skipped one at a time.
+		next := s.internalPrefix + string(utf8.MaxRune)
+		if key >= next {
+			next = key
+		}
+		startAfter = aws.String(next)
+	}
+}
+
+// Count returns the number of objects whose keys start with prefix. It
+// pages through the listing without keeping it in memory.
+func (s *S3Storage) Count(ctx context.Context, prefix string) (int64, error) {
+	bucket := s.readBucket(ctx)
+	count, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (int64, error) {
+		var count int64
+		paginator := s3.NewListObjectsV2Paginator(c, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx, s.readOptFns(ctx)...)
+			if err != nil {
+				return 0, err
+			}
+			for _, obj := range page.Contents {
+				if !s.isHiddenKey(prefix, aws.ToString(obj.Key)) {
+					count++
+				}
+			}
+		}
+		return count, nil
+	})
+	if err != nil {
+		return 0, s.storageError("count", bucket, prefix, err)
+	}
+	return count, nil
+}
+
+// ListSharded lists prefix+shard for every shard concurrently and returns
+// the merged result sorted by key. It is meant for hash-fanout layouts
+// where a single listing of prefix would be too slow. Shards must not
+// overlap, otherwise objects are returned more than once.
+func (s *S3Storage) ListSharded(ctx context.Context, prefix string, shards []string) ([]ObjectInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]ObjectInfo, len(shards))
+	sem := make(chan struct{}, listShardConcurrency)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, shard := range shards {
+		wg.Add(1)
+		go func(i int, shard string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			objects, err := s.List(ctx, prefix+shard)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			results[i] = objects
+		}(i, shard)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var total int
+	for _, r := range results {
+		total += len(r)
+	}
+	merged := make([]ObjectInfo, 0, total)
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Key < merged[j].Key })
+	return merged, nil
+}
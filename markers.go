@@ -0,0 +1,37 @@
+package s3storage
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrDirectoryMarker = errors.New("object is a directory marker")
+
+// MarkerMode decides what Open and Download do with directory markers,
+// the zero-byte "folder/" objects created by consoles and some tools.
+type MarkerMode int
+
+const (
+	// MarkersAsEmpty reads markers as empty objects.
+	MarkersAsEmpty MarkerMode = iota
+	// MarkersFail makes reading a marker fail with ErrDirectoryMarker.
+	MarkersFail
+)
+
+// IsDirectoryMarker reports whether obj is a directory marker rather than
+// a file.
+func IsDirectoryMarker(obj ObjectInfo) bool {
+	return obj.Size == 0 && isMarkerKey(obj.Key)
+}
+
+func isMarkerKey(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// checkMarker returns ErrDirectoryMarker for marker keys if configured so.
+func (s *S3Storage) checkMarker(op, path string) error {
+	if s.markers == MarkersFail && isMarkerKey(path) {
+		return s.storageError(op, s.Bucket, path, ErrDirectoryMarker)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package s3storage
+
+import (
+	"net/url"
+	"time"
+)
+
+// Standard metadata keys shared by all services storing user uploads.
+const (
+	MetaOriginalFilename = "original-filename"
+	MetaUploaderID       = "uploader-id"
+	MetaUploadedAt       = "uploaded-at"
+	MetaIdempotencyKey   = "idempotency-key"
+)
+
+// WithOriginalFilename records the user's original filename and the upload
+// time. The name is percent-encoded, since metadata travels in HTTP headers
+// and must be ASCII.
+func WithOriginalFilename(name string) SaveOption {
+	return func(o *SaveOptions) {
+		WithMetadata(MetaOriginalFilename, url.PathEscape(name))(o)
+		if _, ok := o.Metadata[MetaUploadedAt]; !ok {
+			WithUploadedAt(time.Now())(o)
+		}
+	}
+}
+
+// WithUploaderID records who uploaded the object.
+func WithUploaderID(id string) SaveOption {
+	return WithMetadata(MetaUploaderID, url.PathEscape(id))
+}
+
+// WithUploadedAt records the upload time, overriding the one set by WithOriginalFilename.
+func WithUploadedAt(t time.Time) SaveOption {
+	return WithMetadata(MetaUploadedAt, t.UTC().Format(time.RFC3339))
+}
+
+// WithIdempotencyKey makes Save a no-op when the object at path was already
+// stored with the same key, so an at-least-once pipeline can safely repeat
+// uploads. In that case the reader is not consumed. Keys must be ASCII.
+func WithIdempotencyKey(key string) SaveOption {
+	return func(o *SaveOptions) {
+		o.IdempotencyKey = key
+	}
+}
+
+// OriginalFilename returns the filename recorded with WithOriginalFilename.
+func OriginalFilename(info *ObjectInfo) string {
+	return metaString(info, MetaOriginalFilename)
+}
+
+// UploaderID returns the uploader recorded with WithUploaderID.
+func UploaderID(info *ObjectInfo) string {
+	return metaString(info, MetaUploaderID)
+}
+
+// UploadedAt returns the recorded upload time, if any.
+func UploadedAt(info *ObjectInfo) (time.Time, bool) {
+	if info == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, info.Metadata[MetaUploadedAt])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func metaString(info *ObjectInfo, key string) string {
+	if info == nil {
+		return ""
+	}
+	v := info.Metadata[key]
+	if unescaped, err := url.PathUnescape(v); err == nil {
+		return unescaped
+	}
+	return v
+}
@@ -0,0 +1,458 @@
+package s3storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxShardFailures bounds how many failed keys a shard keeps for the report.
+const maxShardFailures = 100
+
+// listPageSize is how many keys Migration lists at once, S3's maximum.
+const listPageSize = 1000
+
+type ShardState string
+
+const (
+	ShardPending ShardState = "pending"
+	ShardRunning ShardState = "running"
+	ShardDone    ShardState = "done"
+)
+
+// MigrationShard is one unit of work of a Migration, all objects whose keys
+// start with Prefix. It is persisted in the StateStore and updated as the
+// shard is copied, so a worker taking over an abandoned shard continues
+// after LastKey.
+type MigrationShard struct {
+	Prefix     string     `json:"prefix"`
+	State      ShardState `json:"state"`
+	Worker     string     `json:"worker,omitempty"`
+	LeaseUntil time.Time  `json:"lease_until,omitempty"`
+	LastKey    string     `json:"last_key,omitempty"`
+	Copied     int64      `json:"copied"`
+	Skipped    int64      `json:"skipped"`
+	Failed     int64      `json:"failed"`
+	Bytes      int64      `json:"bytes"`
+	// FailedKeys holds the first failures of the shard.
+	FailedKeys []string `json:"failed_keys,omitempty"`
+}
+
+type MigrationConfig struct {
+	// ID names the migration, its state is kept under "<ID>/" in State.
+	ID          string
+	Source      Storage
+	Destination Storage
+	State       StateStore
+	Prefix      string
+	// Shards partition the keyspace under Prefix into prefixes, e.g. the
+	// hex digits of a hash-fanout layout. They must not overlap and must
+	// cover all keys, a single shard of everything if empty.
+	Shards []string
+	// Concurrency is how many objects a worker copies at once, 8 by default.
+	Concurrency int
+	// CheckpointEvery is how many objects are copied between progress
+	// updates, 1000 by default. At most this many are copied again when a
+	// worker dies.
+	CheckpointEvery int
+	// Lease is how long a claimed shard stays with its worker without a
+	// progress update before others may take it over, 10 minutes by default.
+	Lease time.Duration
+	// SizeOnly compares objects by size alone. Set it when ETags are not
+	// MD5 sums of the content, e.g. for buckets encrypted with SSE-KMS,
+	// where equal objects would otherwise always look different.
+	SizeOnly bool
+}
+
+// Migration copies all objects under a prefix from one Storage to another,
+// for example between providers. The keyspace is split into shards kept in
+// a StateStore, so any number of worker processes can run Work at once and
+// crashed workers are replaced without losing progress.
+//
+// Every process creates the same Migration, one of them calls Plan, all of
+// them call Work, and Verify produces the final report. Storages that
+// implement PageLister, like S3Storage, are listed a page at a time, so
+// memory use doesn't grow with the size of a shard.
+//
+// Objects are compared as stored, by size and ETag. Source and Destination
+// must therefore store content the same way: with different Transforms,
+// every object is copied again on each run and Verify reports all of them
+// as mismatches.
+type Migration struct {
+	cfg MigrationConfig
+}
+
+// MigrationReport is the outcome of Verify.
+type MigrationReport struct {
+	Shards  []MigrationShard
+	Objects int64
+	Bytes   int64
+	// Mismatches lists objects missing in the destination or stored with
+	// a different size or ETag.
+	Mismatches []Mismatch
+}
+
+// OK reports whether every shard is done and every object was copied.
+func (r *MigrationReport) OK() bool {
+	if len(r.Mismatches) > 0 {
+		return false
+	}
+	for _, sh := range r.Shards {
+		if sh.State != ShardDone || sh.Failed > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func NewMigration(cfg MigrationConfig) *Migration {
+	if len(cfg.Shards) == 0 {
+		cfg.Shards = []string{""}
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 8
+	}
+	if cfg.CheckpointEvery <= 0 {
+		cfg.CheckpointEvery = 1000
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 10 * time.Minute
+	}
+	return &Migration{cfg: cfg}
+}
+
+// Plan persists the shards of the migration. Shards that already exist are
+// left alone, so it is safe to call from every worker on start.
+func (m *Migration) Plan(ctx context.Context) error {
+	for i, prefix := range m.cfg.Shards {
+		sh := &MigrationShard{Prefix: m.cfg.Prefix + prefix, State: ShardPending}
+		_, err := m.storeShard(ctx, i, sh, "")
+		if err != nil && !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Work claims and copies shards until none is left to claim. Shards held
+// by other live workers are not waited for, so Work may return while the
+// migration is still running elsewhere; use Progress to see the state.
+// worker identifies this process in the shard records.
+func (m *Migration) Work(ctx context.Context, worker string) error {
+	for {
+		i, sh, version, err := m.claim(ctx, worker)
+		if err != nil {
+			return err
+		}
+		if sh == nil {
+			return nil
+		}
+		if err := m.copyShard(ctx, i, sh, version); err != nil {
+			return err
+		}
+	}
+}
+
+// Progress returns the current state of all shards.
+func (m *Migration) Progress(ctx context.Context) ([]MigrationShard, error) {
+	shards := make([]MigrationShard, len(m.cfg.Shards))
+	for i := range m.cfg.Shards {
+		sh, _, err := m.loadShard(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		shards[i] = *sh
+	}
+	return shards, nil
+}
+
+// Verify compares the listings of source and destination shard by shard
+// and reports objects that are missing or differ. Both listings are walked
+// side by side in key order, a page at a time for storages implementing
+// PageLister.
+func (m *Migration) Verify(ctx context.Context) (*MigrationReport, error) {
+	shards, err := m.Progress(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &MigrationReport{Shards: shards}
+
+	for _, sh := range shards {
+		src := newObjectIter(m.cfg.Source, sh.Prefix, "")
+		dst := newObjectIter(m.cfg.Destination, sh.Prefix, "")
+		copied, err := dst.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			obj, err := src.next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if obj == nil {
+				break
+			}
+			report.Objects++
+			report.Bytes += obj.Size
+
+			// Skip objects that only exist in the destination.
+			for copied != nil && copied.Key < obj.Key {
+				if copied, err = dst.next(ctx); err != nil {
+					return nil, err
+				}
+			}
+			switch {
+			case copied == nil || copied.Key != obj.Key:
+				report.Mismatches = append(report.Mismatches, Mismatch{Key: obj.Key, Primary: obj})
+			case !m.same(*obj, *copied):
+				report.Mismatches = append(report.Mismatches, Mismatch{Key: obj.Key, Primary: obj, Secondary: copied})
+			}
+		}
+	}
+	return report, nil
+}
+
+// claim takes over the first shard that is pending or whose lease expired.
+// Returns a nil shard if there is none.
+func (m *Migration) claim(ctx context.Context, worker string) (int, *MigrationShard, string, error) {
+	for i := range m.cfg.Shards {
+		sh, version, err := m.loadShard(ctx, i)
+		if err != nil {
+			return 0, nil, "", err
+		}
+		if sh.State == ShardDone || sh.State == ShardRunning && time.Now().Before(sh.LeaseUntil) {
+			continue
+		}
+
+		sh.State = ShardRunning
+		sh.Worker = worker
+		sh.LeaseUntil = time.Now().Add(m.cfg.Lease)
+		version, err = m.storeShard(ctx, i, sh, version)
+		if errors.Is(err, ErrPreconditionFailed) {
+			// Another worker was faster.
+			continue
+		}
+		if err != nil {
+			return 0, nil, "", err
+		}
+		return i, sh, version, nil
+	}
+	return 0, nil, "", nil
+}
+
+// copyShard copies the objects of a claimed shard after LastKey, storing
+// progress every CheckpointEvery objects. If the shard was taken over by
+// another worker in the meantime it stops without error.
+func (m *Migration) copyShard(ctx context.Context, i int, sh *MigrationShard, version string) error {
+	objects := newObjectIter(m.cfg.Source, sh.Prefix, sh.LastKey)
+	batch := make([]ObjectInfo, 0, m.cfg.CheckpointEvery)
+	for {
+		obj, err := objects.next(ctx)
+		if err != nil {
+			return err
+		}
+		if obj != nil {
+			batch = append(batch, *obj)
+			if len(batch) < m.cfg.CheckpointEvery {
+				continue
+			}
+		}
+
+		if len(batch) > 0 {
+			m.copyBatch(ctx, sh, batch)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sh.LastKey = batch[len(batch)-1].Key
+			batch = batch[:0]
+		}
+		if obj == nil {
+			sh.State = ShardDone
+			sh.LeaseUntil = time.Time{}
+		} else {
+			sh.LeaseUntil = time.Now().Add(m.cfg.Lease)
+		}
+
+		version, err = m.storeShard(ctx, i, sh, version)
+		if errors.Is(err, ErrPreconditionFailed) {
+			return nil
+		}
+		if err != nil || obj == nil {
+			return err
+		}
+	}
+}
+
+// copyBatch copies objects concurrently and adds the results to sh.
+func (m *Migration) copyBatch(ctx context.Context, sh *MigrationShard, objects []ObjectInfo) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, m.cfg.Concurrency)
+	)
+	for _, obj := range objects {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(obj ObjectInfo) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			copied, err := m.copyObject(ctx, obj)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				sh.Failed++
+				if len(sh.FailedKeys) < maxShardFailures {
+					sh.FailedKeys = append(sh.FailedKeys, obj.Key)
+				}
+			case copied:
+				sh.Copied++
+				sh.Bytes += obj.Size
+			default:
+				sh.Skipped++
+			}
+		}(obj)
+	}
+	wg.Wait()
+}
+
+// copyObject copies one object with its content type and metadata. Objects
+// already in the destination are skipped, so redoing work after a crash is
+// cheap.
+func (m *Migration) copyObject(ctx context.Context, obj ObjectInfo) (bool, error) {
+	existing, err := m.cfg.Destination.Stat(ctx, obj.Key)
+	if err == nil && m.same(obj, *existing) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+
+	info, err := m.cfg.Source.Stat(ctx, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	rc, err := m.cfg.Source.Open(ctx, obj.Key)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	opts := []SaveOption{WithContentType(info.ContentType)}
+	for k, v := range info.Metadata {
+		opts = append(opts, WithMetadata(k, v))
+	}
+	if err := m.cfg.Destination.Save(ctx, obj.Key, rc, opts...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// same reports whether dst looks like a copy of src. ETags are compared
+// only when both are plain MD5 sums: multipart ETags depend on the part
+// size, which may differ between the uploads.
+func (m *Migration) same(src, dst ObjectInfo) bool {
+	if src.Size != dst.Size {
+		return false
+	}
+	if m.cfg.SizeOnly || isMultipartETag(src.ETag) || isMultipartETag(dst.ETag) || src.ETag == "" || dst.ETag == "" {
+		return true
+	}
+	return strings.Trim(src.ETag, `"`) == strings.Trim(dst.ETag, `"`)
+}
+
+// isMultipartETag reports whether etag belongs to a multipart upload,
+// "<md5 of the part md5s>-<parts>".
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
+
+// objectIter walks the objects of a prefix in key order. Storages
+// implementing PageLister are read a page at a time, others are listed
+// whole on the first call.
+type objectIter struct {
+	st         Storage
+	prefix     string
+	startAfter string
+
+	buf  []ObjectInfo
+	done bool
+}
+
+func newObjectIter(st Storage, prefix, startAfter string) *objectIter {
+	return &objectIter{st: st, prefix: prefix, startAfter: startAfter}
+}
+
+// next returns the next object, or nil at the end.
+func (it *objectIter) next(ctx context.Context) (*ObjectInfo, error) {
+	for len(it.buf) == 0 {
+		if it.done {
+			return nil, nil
+		}
+		if err := it.fill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	obj := it.buf[0]
+	it.buf = it.buf[1:]
+	return &obj, nil
+}
+
+func (it *objectIter) fill(ctx context.Context) error {
+	if pl, ok := it.st.(PageLister); ok {
+		objects, next, err := pl.ListPage(ctx, it.prefix, it.startAfter, listPageSize)
+		if err != nil {
+			return err
+		}
+		it.buf, it.startAfter, it.done = objects, next, next == ""
+		return nil
+	}
+
+	objects, err := it.st.List(ctx, it.prefix)
+	if err != nil {
+		return err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	start := sort.Search(len(objects), func(i int) bool { return objects[i].Key > it.startAfter })
+	it.buf, it.done = objects[start:], true
+	return nil
+}
+
+func (m *Migration) shardKey(i int) string {
+	return fmt.Sprintf("%s/shard-%06d", m.cfg.ID, i)
+}
+
+func (m *Migration) loadShard(ctx context.Context, i int) (*MigrationShard, string, error) {
+	data, version, err := m.cfg.State.Load(ctx, m.shardKey(i))
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", fmt.Errorf("shard %d of migration %s is not planned", i, m.cfg.ID)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var sh MigrationShard
+	if err := json.Unmarshal(data, &sh); err != nil {
+		return nil, "", fmt.Errorf("failed to decode shard %d of migration %s: %w", i, m.cfg.ID, err)
+	}
+	return &sh, version, nil
+}
+
+func (m *Migration) storeShard(ctx context.Context, i int, sh *MigrationShard, version string) (string, error) {
+	data, err := json.Marshal(sh)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode shard: %w", err)
+	}
+	return m.cfg.State.Store(ctx, m.shardKey(i), data, version)
+}
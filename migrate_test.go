@@ -0,0 +1,35 @@
+package s3storage
+
+import "testing"
+
+func TestMigrationSame(t *testing.T) {
+	const (
+		md5A      = `"0cc175b9c0f1b6a831c399e269772661"`
+		md5B      = `"92eb5ffee6ae2fec3ad71c777531578f"`
+		multipart = `"3858f62230ac3c915f300c664312c11f-2"`
+	)
+
+	tests := []struct {
+		name     string
+		sizeOnly bool
+		src, dst ObjectInfo
+		want     bool
+	}{
+		{name: "equal", src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 1, ETag: md5A}, want: true},
+		{name: "unquoted etag", src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 1, ETag: md5A[1 : len(md5A)-1]}, want: true},
+		{name: "different size", src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 2, ETag: md5A}, want: false},
+		{name: "same size, different content", src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 1, ETag: md5B}, want: false},
+		{name: "multipart source", src: ObjectInfo{Size: 1, ETag: multipart}, dst: ObjectInfo{Size: 1, ETag: md5B}, want: true},
+		{name: "multipart destination", src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 1, ETag: multipart}, want: true},
+		{name: "missing etag", src: ObjectInfo{Size: 1}, dst: ObjectInfo{Size: 1, ETag: md5B}, want: true},
+		{name: "size only", sizeOnly: true, src: ObjectInfo{Size: 1, ETag: md5A}, dst: ObjectInfo{Size: 1, ETag: md5B}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMigration(MigrationConfig{SizeOnly: tt.sizeOnly})
+			if got := m.same(tt.src, tt.dst); got != tt.want {
+				t.Errorf("same() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package s3storage
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Mismatch reports a difference between the primary and the secondary
+// storage for one key. Err is set if the secondary lookup failed.
+type Mismatch struct {
+	Key       string
+	Primary   *ObjectInfo
+	Secondary *ObjectInfo
+	Err       error
+}
+
+type MirrorConfig struct {
+	// Percent of reads, from 0 to 100, that are compared against the secondary.
+	Percent float64
+	// IgnoreETag compares sizes only. ETags of multipart uploads depend on
+	// the part size, so they often differ between providers.
+	IgnoreETag bool
+	// Timeout bounds each comparison.
+	Timeout    time.Duration
+	OnMismatch func(Mismatch)
+}
+
+// Mirror wraps a primary Storage and, for a sample of reads, checks in the
+// background that the secondary holds the same object. All results are
+// served from the primary; the secondary never affects callers.
+type Mirror struct {
+	Storage
+	secondary Storage
+	cfg       MirrorConfig
+	wg        sync.WaitGroup
+}
+
+// NewMirror creates a Mirror serving from primary and validating against secondary.
+func NewMirror(primary, secondary Storage, cfg MirrorConfig) *Mirror {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &Mirror{Storage: primary, secondary: secondary, cfg: cfg}
+}
+
+func (m *Mirror) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := m.Storage.Open(ctx, path)
+	if err == nil {
+		m.sample(ctx, path, nil)
+	}
+	return rc, err
+}
+
+func (m *Mirror) Download(ctx context.Context, path string, w io.WriterAt) error {
+	err := m.Storage.Download(ctx, path, w)
+	if err == nil {
+		m.sample(ctx, path, nil)
+	}
+	return err
+}
+
+func (m *Mirror) Stat(ctx context.Context, path string) (*ObjectInfo, error) {
+	info, err := m.Storage.Stat(ctx, path)
+	if err == nil {
+		m.sample(ctx, path, info)
+	}
+	return info, err
+}
+
+// Close waits for running comparisons to finish.
+func (m *Mirror) Close() error {
+	m.wg.Wait()
+	return nil
+}
+
+func (m *Mirror) sample(ctx context.Context, path string, primary *ObjectInfo) {
+	if m.cfg.OnMismatch == nil || rand.Float64()*100 >= m.cfg.Percent {
+		return
+	}
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.cfg.Timeout)
+		defer cancel()
+		m.compare(ctx, path, primary)
+	}()
+}
+
+func (m *Mirror) compare(ctx context.Context, path string, primary *ObjectInfo) {
+	if primary == nil {
+		var err error
+		primary, err = m.Storage.Stat(ctx, path)
+		if err != nil {
+			// Nothing to compare against, the primary changed under us.
+			return
+		}
+	}
+
+	secondary, err := m.secondary.Stat(ctx, path)
+	if err != nil {
+		// ErrNotFound here means the object was never copied.
+		m.cfg.OnMismatch(Mismatch{Key: path, Primary: primary, Err: err})
+		return
+	}
+
+	if primary.Size != secondary.Size || (!m.cfg.IgnoreETag && primary.ETag != secondary.ETag) {
+		m.cfg.OnMismatch(Mismatch{Key: path, Primary: primary, Secondary: secondary})
+	}
+}
@@ -0,0 +1,16 @@
+package s3storage
+
+import "io"
+
+// mmapConcurrency is how many ranges DownloadMmap fetches in parallel.
+const mmapConcurrency = 8
+
+// byteWriterAt writes into a fixed size buffer, e.g. a file mapping.
+type byteWriterAt []byte
+
+func (b byteWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(b)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(b[off:], p), nil
+}
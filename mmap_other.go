@@ -0,0 +1,30 @@
+//go:build !unix
+
+package s3storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// DownloadMmap downloads an object into localPath and returns its
+// contents. Memory mapping is only available on unix; elsewhere the file
+// is read into memory and the close function does nothing.
+func (s *S3Storage) DownloadMmap(ctx context.Context, path, localPath string) ([]byte, func() error, error) {
+	f, err := os.OpenFile(localPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	err = s.Download(ctx, path, f)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
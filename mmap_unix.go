@@ -0,0 +1,105 @@
+//go:build unix
+
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DownloadMmap downloads an object into localPath and returns the file
+// memory-mapped. The file is allocated up front, so a full disk fails the
+// call with ENOSPC instead of crashing it with SIGBUS later, and ranges are
+// downloaded in parallel straight into the mapping, so large indexes load
+// without extra copies. The returned bytes are mapped read-only, writing
+// to them faults. They are valid until the close function is called.
+func (s *S3Storage) DownloadMmap(ctx context.Context, path, localPath string) ([]byte, func() error, error) {
+	f, err := os.OpenFile(localPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	// The mapping stays valid after the file is closed.
+	defer f.Close()
+
+	// Transformed objects don't know their decoded size, so they go
+	// through the file first.
+	if len(s.transforms) > 0 {
+		if err := s.Download(ctx, path, f); err != nil {
+			return nil, nil, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		return mmapFile(f, fi.Size(), syscall.PROT_READ)
+	}
+
+	info, err := s.Stat(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := preallocate(f, info.Size); err != nil {
+		return nil, nil, fmt.Errorf("failed to allocate %s: %w", localPath, err)
+	}
+	data, unmap, err := mmapFile(f, info.Size, syscall.PROT_READ|syscall.PROT_WRITE)
+	if err != nil || len(data) == 0 {
+		return data, unmap, err
+	}
+
+	bucket := s.readBucket(ctx)
+	_, err = readFallback(ctx, s, func(_ *s3.Client, d *manager.Downloader) (int64, error) {
+		return d.Download(ctx, byteWriterAt(data), &s3.GetObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(path),
+			IfMatch: aws.String(info.ETag),
+		}, s.readDownloaderOpts(ctx), func(d *manager.Downloader) {
+			d.Concurrency = mmapConcurrency
+		})
+	})
+	if err != nil {
+		unmap()
+		var er *types.NoSuchKey
+		if errors.As(err, &er) {
+			return nil, nil, s.storageError("download", bucket, path, ErrNotFound)
+		}
+		return nil, nil, s.storageError("download", bucket, path, err)
+	}
+
+	// Hand out a read-only view, the data is shared with the file.
+	if err := unmap(); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmap %s: %w", localPath, err)
+	}
+	return mmapFile(f, info.Size, syscall.PROT_READ)
+}
+
+func mmapFile(f *os.File, size int64, prot int) ([]byte, func() error, error) {
+	if size == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), prot, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map %s: %w", f.Name(), err)
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
+
+// writeZeros allocates size bytes of f by writing them, for filesystems
+// without fallocate.
+func writeZeros(f *os.File, size int64) error {
+	zeros := make([]byte, 1<<20)
+	for off := int64(0); off < size; off += int64(len(zeros)) {
+		n := min(int64(len(zeros)), size-off)
+		if _, err := f.WriteAt(zeros[:n], off); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package s3storage
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type bucketOverrideKey struct{}
+
+type regionOverrideKey struct{}
+
+// WithBucketOverride makes read methods (Open, Download, DownloadMmap,
+// Exists, Stat, List and the range readers) called with ctx read from
+// bucket instead of the configured one, for occasional cross-bucket reads
+// without creating another storage. Writes ignore it, including the reads
+// they make themselves, like the idempotency check of Save.
+func WithBucketOverride(ctx context.Context, bucket string) context.Context {
+	return context.WithValue(ctx, bucketOverrideKey{}, bucket)
+}
+
+// WithRegionOverride makes read methods called with ctx send requests to
+// region, usually together with WithBucketOverride.
+func WithRegionOverride(ctx context.Context, region string) context.Context {
+	return context.WithValue(ctx, regionOverrideKey{}, region)
+}
+
+// withoutOverrides returns ctx with the bucket and region overrides
+// cleared, for reads that are part of a write to the configured bucket.
+func withoutOverrides(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, bucketOverrideKey{}, "")
+	return context.WithValue(ctx, regionOverrideKey{}, "")
+}
+
+// readBucket returns the bucket to read from with ctx.
+func (s *S3Storage) readBucket(ctx context.Context) string {
+	if bucket, ok := ctx.Value(bucketOverrideKey{}).(string); ok && bucket != "" {
+		return bucket
+	}
+	return s.Bucket
+}
+
+// readOptFns is optFns(opRead) plus the region override of ctx.
+func (s *S3Storage) readOptFns(ctx context.Context) []func(*s3.Options) {
+	fns := s.optFns(opRead)
+	if region, ok := ctx.Value(regionOverrideKey{}).(string); ok && region != "" {
+		fns = append(slices.Clip(fns), func(o *s3.Options) { o.Region = region })
+	}
+	return fns
+}
+
+func (s *S3Storage) readDownloaderOpts(ctx context.Context) func(*manager.Downloader) {
+	fns := s.readOptFns(ctx)
+	return func(d *manager.Downloader) {
+		d.ClientOptions = append(slices.Clip(d.ClientOptions), fns...)
+	}
+}
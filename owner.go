@@ -0,0 +1,25 @@
+package s3storage
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+const expectedBucketOwnerHeader = "X-Amz-Expected-Bucket-Owner"
+
+// withExpectedBucketOwner sends owner as the expected bucket owner with every
+// request, unless the input already sets one. S3 rejects requests to buckets
+// of other accounts with 403 Access Denied.
+func withExpectedBucketOwner(owner string) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("ExpectedBucketOwner",
+			func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+				if req, ok := in.Request.(*smithyhttp.Request); ok && req.Header.Get(expectedBucketOwnerHeader) == "" {
+					req.Header.Set(expectedBucketOwnerHeader, owner)
+				}
+				return next.HandleBuild(ctx, in)
+			}), middleware.After)
+	}
+}
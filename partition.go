@@ -0,0 +1,88 @@
+package s3storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DateLayout describes keys partitioned by date, like
+// "logs/2024/05/17/app-1.log". Partitioned keys let ListBetween list only
+// the partitions of a time window instead of the whole prefix.
+type DateLayout struct {
+	Prefix string
+	// Format is the time layout of the partition part of the key, e.g.
+	// "2006/01/02/" for daily or "dt=2006-01-02/hh=15/" for hourly
+	// partitions. Use zero-padded fields, so that no partition is a
+	// prefix of another.
+	Format string
+	// Step is the size of the smallest partition, 24 hours by default.
+	// Leave it at a day for partitions of varying length, like months.
+	Step time.Duration
+	// Location partitions are cut in, UTC if nil.
+	Location *time.Location
+}
+
+// Key returns the key of name in the partition of t.
+func (l DateLayout) Key(t time.Time, name string) string {
+	return l.partition(t) + name
+}
+
+func (l DateLayout) partition(t time.Time) string {
+	loc := l.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return l.Prefix + t.In(loc).Format(l.Format)
+}
+
+// ListBetween returns objects in the partitions of layout overlapping the
+// window from..to, listing them concurrently. Filtering is done at
+// partition granularity, so objects at the edges of the window may fall
+// slightly outside it.
+func (s *S3Storage) ListBetween(ctx context.Context, layout DateLayout, from, to time.Time) ([]ObjectInfo, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("invalid window %v to %v", from, to)
+	}
+	return s.ListSharded(ctx, "", layout.partitions(from, to))
+}
+
+// partitions returns the prefixes of all partitions overlapping from..to.
+// Walking the window in steps no larger than a partition visits every
+// partition at least once. Steps of whole days are taken in calendar days
+// of Location, a day is 23 or 25 hours long when DST changes.
+func (l DateLayout) partitions(from, to time.Time) []string {
+	step := l.Step
+	if step <= 0 {
+		step = 24 * time.Hour
+	}
+	loc := l.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	days := 0
+	if step%(24*time.Hour) == 0 {
+		days = int(step / (24 * time.Hour))
+	}
+	next := func(t time.Time) time.Time {
+		if days > 0 {
+			return t.AddDate(0, 0, days)
+		}
+		return t.Add(step)
+	}
+
+	seen := make(map[string]bool)
+	var prefixes []string
+	add := func(t time.Time) {
+		p := l.partition(t)
+		if !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	for t := from.In(loc); t.Before(to); t = next(t) {
+		add(t)
+	}
+	add(to)
+	return prefixes
+}
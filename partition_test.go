@@ -0,0 +1,72 @@
+package s3storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDateLayoutPartitions(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+
+	tests := []struct {
+		name     string
+		layout   DateLayout
+		from, to time.Time
+		want     []string
+	}{
+		{
+			name:   "daily",
+			layout: DateLayout{Prefix: "logs/", Format: "2006/01/02/"},
+			from:   time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC),
+			want:   []string{"logs/2024/05/30/", "logs/2024/05/31/", "logs/2024/06/01/"},
+		},
+		{
+			name:   "daily across spring DST change",
+			layout: DateLayout{Format: "2006/01/02/", Location: berlin},
+			from:   time.Date(2024, 3, 30, 23, 30, 0, 0, berlin),
+			to:     time.Date(2024, 4, 2, 0, 0, 0, 0, berlin),
+			want:   []string{"2024/03/30/", "2024/03/31/", "2024/04/01/", "2024/04/02/"},
+		},
+		{
+			name:   "daily across autumn DST change",
+			layout: DateLayout{Format: "2006/01/02/", Location: berlin},
+			from:   time.Date(2024, 10, 26, 0, 30, 0, 0, berlin),
+			to:     time.Date(2024, 10, 28, 0, 10, 0, 0, berlin),
+			want:   []string{"2024/10/26/", "2024/10/27/", "2024/10/28/"},
+		},
+		{
+			name:   "hourly",
+			layout: DateLayout{Format: "dt=2006-01-02/hh=15/", Step: time.Hour},
+			from:   time.Date(2024, 1, 1, 22, 30, 0, 0, time.UTC),
+			to:     time.Date(2024, 1, 2, 0, 15, 0, 0, time.UTC),
+			want:   []string{"dt=2024-01-01/hh=22/", "dt=2024-01-01/hh=23/", "dt=2024-01-02/hh=00/"},
+		},
+		{
+			name:   "monthly",
+			layout: DateLayout{Format: "2006/01/"},
+			from:   time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			want:   []string{"2024/01/", "2024/02/", "2024/03/"},
+		},
+		{
+			name:   "single instant",
+			layout: DateLayout{Format: "2006/01/02/"},
+			from:   time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			to:     time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC),
+			want:   []string{"2024/01/01/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.layout.partitions(tt.from, tt.to)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("partitions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
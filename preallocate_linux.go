@@ -0,0 +1,19 @@
+package s3storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// preallocate reserves disk blocks for size bytes of f, so that writes
+// through a mapping of it can't run out of space.
+func preallocate(f *os.File, size int64) error {
+	if size == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return writeZeros(f, size)
+	}
+	return err
+}
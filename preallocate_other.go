@@ -0,0 +1,11 @@
+//go:build unix && !linux
+
+package s3storage
+
+import "os"
+
+// preallocate reserves disk blocks for size bytes of f, so that writes
+// through a mapping of it can't run out of space.
+func preallocate(f *os.File, size int64) error {
+	return writeZeros(f, size)
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// blockCache keeps blocks as files in a directory and evicts the least
+// recently used ones once the total size exceeds maxBytes. Files left from
+// a previous run are picked up on first use.
+type blockCache struct {
+	dir      string
+	maxBytes int64
+
+	once  sync.Once
+	mu    sync.Mutex
+	lru   *list.List
+	files map[string]*list.Element
+	size  int64
+}
+
+type cacheFile struct {
+	name string
+	size int64
+}
+
+func newBlockCache(dir string, maxBytes int64) *blockCache {
+	return &blockCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		files:    make(map[string]*list.Element),
+	}
+}
+
+// blockName derives a file name for a block of one object version.
+func blockName(key, etag string, idx int64) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + etag))
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), idx)
+}
+
+func (c *blockCache) get(name string) ([]byte, bool) {
+	c.once.Do(c.load)
+
+	c.mu.Lock()
+	el, ok := c.files[name]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		c.remove(name)
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *blockCache) put(name string, data []byte) error {
+	c.once.Do(c.load)
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(name, int64(len(data)))
+	c.evict()
+	return nil
+}
+
+// add records a file as most recently used. c.mu must be held.
+func (c *blockCache) add(name string, size int64) {
+	if el, ok := c.files[name]; ok {
+		c.size -= el.Value.(*cacheFile).size
+		c.lru.Remove(el)
+	}
+	c.files[name] = c.lru.PushFront(&cacheFile{name: name, size: size})
+	c.size += size
+}
+
+// evict removes files until the cache fits into maxBytes. c.mu must be held.
+func (c *blockCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		el := c.lru.Back()
+		f := el.Value.(*cacheFile)
+		c.lru.Remove(el)
+		delete(c.files, f.name)
+		c.size -= f.size
+		os.Remove(filepath.Join(c.dir, f.name))
+	}
+}
+
+func (c *blockCache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.files[name]; ok {
+		c.size -= el.Value.(*cacheFile).size
+		c.lru.Remove(el)
+		delete(c.files, name)
+	}
+}
+
+// load indexes files from a previous run, oldest first.
+func (c *blockCache) load() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	type found struct {
+		name string
+		info os.FileInfo
+	}
+	var files []found
+	for _, e := range entries {
+		if e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, found{e.Name(), info})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.add(f.name, f.info.Size())
+	}
+	c.evict()
+}
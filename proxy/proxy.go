@@ -0,0 +1,290 @@
+// Package proxy serves objects over HTTP with a local disk cache of byte
+// ranges, meant to run as a sidecar in front of S3 for media serving.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	s3storage "github.com/levmv/go-s3-storage"
+)
+
+const (
+	defaultBlockSize     = 1024 * 1024
+	defaultMaxCacheBytes = 1024 * 1024 * 1024
+
+	// maxRestarts is how often a request is served again when the object
+	// is replaced while its blocks are fetched.
+	maxRestarts = 2
+)
+
+// Source is the subset of storage operations the proxy needs.
+// *s3storage.S3Storage implements it.
+type Source interface {
+	Stat(ctx context.Context, path string) (*s3storage.ObjectInfo, error)
+	OpenRange(ctx context.Context, path string, offset, length int64, opts ...s3storage.RangeOption) (io.ReadCloser, error)
+}
+
+type Options struct {
+	// CacheDir holds cached blocks. Defaults to a directory under os.TempDir.
+	CacheDir      string
+	BlockSize     int64
+	MaxCacheBytes int64
+	// Prefix is stripped from the request path to get the object key,
+	// requests to paths outside it are answered with 404. It matches whole
+	// path segments only.
+	Prefix string
+}
+
+type Option func(*Options)
+
+func WithCacheDir(dir string) Option {
+	return func(o *Options) {
+		o.CacheDir = dir
+	}
+}
+
+func WithBlockSize(n int64) Option {
+	return func(o *Options) {
+		o.BlockSize = n
+	}
+}
+
+func WithMaxCacheBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxCacheBytes = n
+	}
+}
+
+func WithPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.Prefix = prefix
+	}
+}
+
+type handler struct {
+	src   Source
+	cache *blockCache
+	opts  Options
+}
+
+// New returns a handler serving GET and HEAD requests for objects of src,
+// with support for Range and conditional requests. Object data is fetched
+// in blocks, which are kept on disk and reused across requests; blocks are
+// keyed by ETag, so a replaced object is never served stale data.
+func New(src Source, opts ...Option) http.Handler {
+	options := Options{
+		BlockSize:     defaultBlockSize,
+		MaxCacheBytes: defaultMaxCacheBytes,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.BlockSize <= 0 {
+		options.BlockSize = defaultBlockSize
+	}
+	if options.CacheDir == "" {
+		options.CacheDir = filepath.Join(os.TempDir(), "s3storage-proxy")
+	}
+
+	return &handler{
+		src:   src,
+		cache: newBlockCache(options.CacheDir, options.MaxCacheBytes),
+		opts:  options,
+	}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Paths outside Prefix are not served, they would map to keys outside
+	// the mount.
+	path, ok := cutPathPrefix(r.URL.Path, h.opts.Prefix)
+	key := strings.TrimPrefix(path, "/")
+	if !ok || key == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Block fetches fail with ErrPreconditionFailed when the object was
+	// replaced after Stat. Until the first body byte is written the
+	// response can still be built again from the new version.
+	for attempt := 0; ; attempt++ {
+		rw := &deferredWriter{w: w, header: make(http.Header)}
+		err := h.serve(rw, r, key)
+		if errors.Is(err, s3storage.ErrPreconditionFailed) && !rw.committed && attempt < maxRestarts {
+			continue
+		}
+		switch {
+		case rw.committed:
+			// The body is under way, a failure can only cut it short.
+		case errors.Is(err, s3storage.ErrNotFound):
+			http.NotFound(w, r)
+		case err != nil:
+			http.Error(w, "failed to fetch object", http.StatusBadGateway)
+		default:
+			rw.commit()
+		}
+		return
+	}
+}
+
+// serve answers r for the object at key. Errors are returned as long as
+// the response may still be replaced.
+func (h *handler) serve(w http.ResponseWriter, r *http.Request, key string) error {
+	info, err := h.src.Stat(r.Context(), key)
+	if err != nil {
+		return err
+	}
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	obj := &objectReader{
+		ctx:  r.Context(),
+		h:    h,
+		key:  key,
+		etag: info.ETag,
+		size: info.Size,
+	}
+	http.ServeContent(w, r, key, info.LastModified, obj)
+	return obj.err
+}
+
+// deferredWriter holds back the status line and headers until the first
+// body write, so a response can be discarded and built again.
+type deferredWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	status    int
+	committed bool
+}
+
+func (d *deferredWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *deferredWriter) WriteHeader(status int) {
+	if d.status == 0 {
+		d.status = status
+	}
+}
+
+func (d *deferredWriter) Write(p []byte) (int, error) {
+	d.commit()
+	return d.w.Write(p)
+}
+
+func (d *deferredWriter) commit() {
+	if d.committed {
+		return
+	}
+	d.committed = true
+	maps.Copy(d.w.Header(), d.header)
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	d.w.WriteHeader(d.status)
+}
+
+// cutPathPrefix is strings.CutPrefix respecting path segments: prefix
+// "/media" matches "/media" and "/media/a", but not "/media-private/a".
+func cutPathPrefix(path, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok || prefix == "" || strings.HasSuffix(prefix, "/") {
+		return rest, ok
+	}
+	if rest != "" && !strings.HasPrefix(rest, "/") {
+		return "", false
+	}
+	return rest, true
+}
+
+// objectReader is an io.ReadSeeker over an object, reading through the block cache.
+type objectReader struct {
+	ctx  context.Context
+	h    *handler
+	key  string
+	etag string
+	size int64
+	pos  int64
+	err  error
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.pos >= o.size {
+		return 0, io.EOF
+	}
+	bs := o.h.opts.BlockSize
+	idx := o.pos / bs
+	block, err := o.h.block(o.ctx, o.key, o.etag, idx, min(bs, o.size-idx*bs))
+	if err != nil {
+		o.err = err
+		return 0, err
+	}
+	n := copy(p, block[o.pos-idx*bs:])
+	o.pos += int64(n)
+	return n, nil
+}
+
+func (o *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.pos
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	o.pos = offset
+	return offset, nil
+}
+
+// block returns a block from the disk cache, fetching it on a miss. The
+// fetch is pinned to etag, so a replaced object fails with
+// ErrPreconditionFailed instead of caching new data under the old ETag.
+func (h *handler) block(ctx context.Context, key, etag string, idx, length int64) ([]byte, error) {
+	name := blockName(key, etag, idx)
+	if data, ok := h.cache.get(name); ok && int64(len(data)) == length {
+		return data, nil
+	}
+
+	var opts []s3storage.RangeOption
+	if etag != "" {
+		opts = append(opts, s3storage.WithIfMatch(etag))
+	}
+	rc, err := h.src.OpenRange(ctx, key, idx*h.opts.BlockSize, length, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != length {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// A failed cache write only costs a refetch next time.
+	_ = h.cache.put(name, data)
+	return data, nil
+}
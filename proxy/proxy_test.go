@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	s3storage "github.com/levmv/go-s3-storage"
+)
+
+func TestCutPathPrefix(t *testing.T) {
+	tests := []struct {
+		path, prefix string
+		want         string
+		ok           bool
+	}{
+		{path: "/a/b", prefix: "", want: "/a/b", ok: true},
+		{path: "/media/a/b", prefix: "/media", want: "/a/b", ok: true},
+		{path: "/media", prefix: "/media", want: "", ok: true},
+		{path: "/media-private/a", prefix: "/media", ok: false},
+		{path: "/mediafile", prefix: "/media", ok: false},
+		{path: "/media/a", prefix: "/media/", want: "a", ok: true},
+		{path: "/media", prefix: "/media/", ok: false},
+		{path: "/other/a", prefix: "/media", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.prefix, func(t *testing.T) {
+			got, ok := cutPathPrefix(tt.path, tt.prefix)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("cutPathPrefix(%q, %q) = %q, %v; want %q, %v", tt.path, tt.prefix, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// versionedSource serves an object that is replaced with new content
+// right after the first Stat.
+type versionedSource struct {
+	mu       sync.Mutex
+	versions [][]byte
+	current  int
+	stats    int
+}
+
+func (v *versionedSource) etag() string {
+	return fmt.Sprintf(`"v%d"`, v.current)
+}
+
+func (v *versionedSource) Stat(ctx context.Context, path string) (*s3storage.ObjectInfo, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	info := &s3storage.ObjectInfo{Key: path, Size: int64(len(v.versions[v.current])), ETag: v.etag()}
+	v.stats++
+	if v.stats == 1 {
+		v.current++
+	}
+	return info, nil
+}
+
+func (v *versionedSource) OpenRange(ctx context.Context, path string, offset, length int64, opts ...s3storage.RangeOption) (io.ReadCloser, error) {
+	var options s3storage.RangeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if options.IfMatch != "" && options.IfMatch != v.etag() {
+		return nil, s3storage.ErrPreconditionFailed
+	}
+	data := v.versions[v.current]
+	return io.NopCloser(bytes.NewReader(data[offset : offset+length])), nil
+}
+
+func TestReplacedObjectIsServedAgain(t *testing.T) {
+	src := &versionedSource{versions: [][]byte{[]byte("old content"), []byte("new content, longer")}}
+	srv := httptest.NewServer(New(src, WithCacheDir(t.TempDir()), WithBlockSize(4)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "new content, longer" {
+		t.Errorf("got %s %q, want the new version", resp.Status, body)
+	}
+	if got := resp.Header.Get("ETag"); got != `"v1"` {
+		t.Errorf("ETag = %s, want \"v1\"", got)
+	}
+	if src.stats != 2 {
+		t.Errorf("object was stat'ed %d times, want 2", src.stats)
+	}
+}
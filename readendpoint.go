@@ -0,0 +1,47 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type primaryReadsKey struct{}
+
+// withPrimaryReads makes reads with ctx skip the read endpoint, for reads
+// that must see the latest writes, like the checks inside write operations.
+// A replica behind the read endpoint may still serve an older version.
+func withPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsKey{}, true)
+}
+
+// readFallback runs read against the read endpoint and, if that is
+// unreachable or fails with a server error, once more against the write
+// endpoint. Answers like 404 or 412 are final: the replica may lag behind,
+// but retrying them would double the cost of every miss. Without a read
+// endpoint, or with withPrimaryReads, read runs once on the write client.
+func readFallback[T any](ctx context.Context, s *S3Storage, read func(*s3.Client, *manager.Downloader) (T, error)) (T, error) {
+	c := s.clients.Load()
+	if primary, _ := ctx.Value(primaryReadsKey{}).(bool); c.reader == nil || primary {
+		return read(c.client, c.downloader)
+	}
+	v, err := read(c.reader, c.readDownloader)
+	if err == nil || ctx.Err() != nil || !isUnavailable(err) {
+		return v, err
+	}
+	return read(c.client, c.downloader)
+}
+
+// isUnavailable reports whether err means the endpoint couldn't answer: no
+// response at all, or a 5xx one.
+func isUnavailable(err error) bool {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return true
+	}
+	return respErr.HTTPStatusCode() >= http.StatusInternalServerError
+}
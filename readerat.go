@@ -0,0 +1,246 @@
+package s3storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultBlockSize   = 1024 * 1024
+	defaultCacheBlocks = 32
+	defaultReadAhead   = 2
+	footerPrefetchSize = 64 * 1024
+)
+
+type ReaderAtOptions struct {
+	BlockSize   int64
+	CacheBlocks int
+	ReadAhead   int
+}
+
+type ReaderAtOption func(*ReaderAtOptions)
+
+// WithBlockSize sets the size of the cached blocks ranged reads are aligned to.
+func WithBlockSize(n int64) ReaderAtOption {
+	return func(o *ReaderAtOptions) {
+		o.BlockSize = n
+	}
+}
+
+// WithCacheBlocks sets how many blocks are kept in memory.
+func WithCacheBlocks(n int) ReaderAtOption {
+	return func(o *ReaderAtOptions) {
+		o.CacheBlocks = n
+	}
+}
+
+// WithReadAhead sets how many blocks following a miss are fetched in the
+// same request.
+func WithReadAhead(n int) ReaderAtOption {
+	return func(o *ReaderAtOptions) {
+		o.ReadAhead = n
+	}
+}
+
+// ReaderAt provides random access to an object through ranged reads.
+// It is tuned for columnar formats like parquet: the tail of the object,
+// where the footer lives, is fetched up front, and misses are served in
+// blocks with read-ahead, kept in a small LRU cache. Reads are pinned to
+// the version of the object seen when the ReaderAt was created: if it is
+// overwritten later, ReadAt fails with ErrPreconditionFailed instead of
+// mixing blocks of both versions.
+// ReaderAt is safe for concurrent use.
+type ReaderAt struct {
+	s    *S3Storage
+	ctx  context.Context
+	path string
+	size int64
+	etag string
+	opts ReaderAtOptions
+
+	tail    []byte
+	tailOff int64
+
+	mu     sync.Mutex
+	lru    *list.List
+	blocks map[int64]*list.Element
+}
+
+type cachedBlock struct {
+	idx  int64
+	data []byte
+}
+
+// NewReaderAt returns a ReaderAt for the object at path. All reads are done
+// with ctx, so it must stay valid for the lifetime of the ReaderAt.
+func (s *S3Storage) NewReaderAt(ctx context.Context, path string, opts ...ReaderAtOption) (*ReaderAt, error) {
+	options := ReaderAtOptions{
+		BlockSize:   defaultBlockSize,
+		CacheBlocks: defaultCacheBlocks,
+		ReadAhead:   defaultReadAhead,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.BlockSize <= 0 {
+		options.BlockSize = defaultBlockSize
+	}
+	options.ReadAhead = max(options.ReadAhead, 0)
+	options.CacheBlocks = max(options.CacheBlocks, options.ReadAhead+1)
+
+	info, err := s.Stat(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ReaderAt{
+		s:      s,
+		ctx:    ctx,
+		path:   path,
+		size:   info.Size,
+		etag:   info.ETag,
+		opts:   options,
+		lru:    list.New(),
+		blocks: make(map[int64]*list.Element),
+	}
+
+	if r.size > 0 {
+		r.tailOff = max(r.size-footerPrefetchSize, 0)
+		r.tail, err = s.readRange(ctx, path, fmt.Sprintf("bytes=%d-%d", r.tailOff, r.size-1), r.etag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Size returns the size of the object.
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), r.size)
+
+	if off >= r.tailOff && r.tail != nil {
+		n := copy(p, r.tail[off-r.tailOff:end-r.tailOff])
+		return n, r.eofAt(off + int64(n))
+	}
+
+	first := off / r.opts.BlockSize
+	last := (end - 1) / r.opts.BlockSize
+	if err := r.fetchMissing(first, last); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for idx := first; idx <= last; idx++ {
+		data, ok := r.block(idx)
+		if !ok {
+			// Evicted by a concurrent reader, fetch it again.
+			if err := r.fetchMissing(idx, idx); err != nil {
+				return n, err
+			}
+			if data, ok = r.block(idx); !ok {
+				return n, fmt.Errorf("block %d of %s is not cacheable", idx, r.path)
+			}
+		}
+		blockStart := idx * r.opts.BlockSize
+		from := max(off, blockStart) - blockStart
+		to := min(end, blockStart+int64(len(data))) - blockStart
+		n += copy(p[n:], data[from:to])
+	}
+	return n, r.eofAt(off + int64(n))
+}
+
+func (r *ReaderAt) eofAt(pos int64) error {
+	if pos >= r.size {
+		return io.EOF
+	}
+	return nil
+}
+
+// block returns a cached block and marks it as recently used.
+func (r *ReaderAt) block(idx int64) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	el, ok := r.blocks[idx]
+	if !ok {
+		return nil, false
+	}
+	r.lru.MoveToFront(el)
+	return el.Value.(*cachedBlock).data, true
+}
+
+// fetchMissing loads blocks first..last that are not cached, merging
+// consecutive misses into single requests and extending the last one by
+// the read-ahead window.
+func (r *ReaderAt) fetchMissing(first, last int64) error {
+	lastBlock := (r.size - 1) / r.opts.BlockSize
+
+	r.mu.Lock()
+	var runs [][2]int64
+	var misses int64
+	for idx := first; idx <= last; idx++ {
+		if _, ok := r.blocks[idx]; ok {
+			continue
+		}
+		misses++
+		if n := len(runs); n > 0 && runs[n-1][1] == idx-1 {
+			runs[n-1][1] = idx
+		} else {
+			runs = append(runs, [2]int64{idx, idx})
+		}
+	}
+	r.mu.Unlock()
+	r.s.stats.cacheHits.Add(last - first + 1 - misses)
+	r.s.stats.cacheMisses.Add(misses)
+
+	if len(runs) == 0 {
+		return nil
+	}
+	runs[len(runs)-1][1] = min(runs[len(runs)-1][1]+int64(r.opts.ReadAhead), lastBlock)
+
+	for _, run := range runs {
+		start := run[0] * r.opts.BlockSize
+		end := min((run[1]+1)*r.opts.BlockSize, r.size)
+		data, err := r.s.readRange(r.ctx, r.path, fmt.Sprintf("bytes=%d-%d", start, end-1), r.etag)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != end-start {
+			return fmt.Errorf("short read of %s: got %d bytes, expected %d", r.path, len(data), end-start)
+		}
+		for idx := run[0]; idx <= run[1]; idx++ {
+			from := (idx - run[0]) * r.opts.BlockSize
+			r.store(idx, data[from:min(from+r.opts.BlockSize, int64(len(data)))])
+		}
+	}
+	return nil
+}
+
+// store adds a block to the cache, evicting the least recently used ones.
+func (r *ReaderAt) store(idx int64, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.blocks[idx]; ok {
+		r.lru.MoveToFront(el)
+		return
+	}
+	r.blocks[idx] = r.lru.PushFront(&cachedBlock{idx: idx, data: data})
+	for r.lru.Len() > r.opts.CacheBlocks {
+		el := r.lru.Back()
+		r.lru.Remove(el)
+		delete(r.blocks, el.Value.(*cachedBlock).idx)
+	}
+}
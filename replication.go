@@ -0,0 +1,186 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// rtcMinutes is the only threshold S3 Replication Time Control supports.
+const rtcMinutes = 15
+
+// Replication is a simplified bucket replication configuration. Both
+// buckets must have versioning enabled.
+type Replication struct {
+	// Role is the ARN of the IAM role S3 assumes to replicate objects.
+	Role  string
+	Rules []ReplicationRule
+}
+
+// ReplicationRule replicates objects matching Prefix and Tags to
+// DestinationBucket.
+type ReplicationRule struct {
+	ID string
+	// Priority decides between rules matching the same object, higher wins.
+	Priority int32
+	Disabled bool
+	Prefix   string
+	Tags     map[string]string
+	// DestinationBucket is a bucket name or ARN.
+	DestinationBucket string
+	// StorageClass of the replicas, the source object's class if empty.
+	StorageClass string
+	// ReplicateDeletes also replicates delete markers.
+	ReplicateDeletes bool
+	// RTC enables Replication Time Control with its 15 minute SLA and metrics.
+	RTC bool
+}
+
+// PutReplication replaces the replication configuration of the bucket.
+func (s *S3Storage) PutReplication(ctx context.Context, cfg Replication) error {
+	rc := &types.ReplicationConfiguration{Role: aws.String(cfg.Role)}
+	for _, rule := range cfg.Rules {
+		rc.Rules = append(rc.Rules, rule.toSDK())
+	}
+	_, err := s.client().PutBucketReplication(ctx, &s3.PutBucketReplicationInput{
+		Bucket:                   aws.String(s.Bucket),
+		ReplicationConfiguration: rc,
+	}, s.optFns(opWrite)...)
+	if err != nil {
+		return s.storageError("set replication", s.Bucket, "", err)
+	}
+	return nil
+}
+
+// GetReplication returns the replication configuration of the bucket, or
+// ErrNotFound if there is none.
+func (s *S3Storage) GetReplication(ctx context.Context) (*Replication, error) {
+	resp, err := s.client().GetBucketReplication(ctx, &s3.GetBucketReplicationInput{
+		Bucket: aws.String(s.Bucket),
+	}, s.optFns(opRead)...)
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ReplicationConfigurationNotFoundError" {
+			return nil, s.storageError("get replication", s.Bucket, "", ErrNotFound)
+		}
+		return nil, s.storageError("get replication", s.Bucket, "", err)
+	}
+	if resp.ReplicationConfiguration == nil {
+		return nil, ErrNotFound
+	}
+
+	cfg := &Replication{Role: aws.ToString(resp.ReplicationConfiguration.Role)}
+	for _, rule := range resp.ReplicationConfiguration.Rules {
+		cfg.Rules = append(cfg.Rules, replicationRuleFromSDK(rule))
+	}
+	return cfg, nil
+}
+
+// DeleteReplication removes the replication configuration of the bucket.
+func (s *S3Storage) DeleteReplication(ctx context.Context) error {
+	_, err := s.client().DeleteBucketReplication(ctx, &s3.DeleteBucketReplicationInput{
+		Bucket: aws.String(s.Bucket),
+	}, s.optFns(opDelete)...)
+	if err != nil {
+		return s.storageError("delete replication", s.Bucket, "", err)
+	}
+	return nil
+}
+
+func (r ReplicationRule) toSDK() types.ReplicationRule {
+	dest := r.DestinationBucket
+	if !strings.HasPrefix(dest, "arn:") {
+		dest = "arn:aws:s3:::" + dest
+	}
+
+	rule := types.ReplicationRule{
+		Priority:    aws.Int32(r.Priority),
+		Status:      types.ReplicationRuleStatusEnabled,
+		Destination: &types.Destination{Bucket: aws.String(dest)},
+		DeleteMarkerReplication: &types.DeleteMarkerReplication{
+			Status: types.DeleteMarkerReplicationStatusDisabled,
+		},
+	}
+	if r.ID != "" {
+		rule.ID = aws.String(r.ID)
+	}
+	if r.Disabled {
+		rule.Status = types.ReplicationRuleStatusDisabled
+	}
+	if r.ReplicateDeletes {
+		rule.DeleteMarkerReplication.Status = types.DeleteMarkerReplicationStatusEnabled
+	}
+	if r.StorageClass != "" {
+		rule.Destination.StorageClass = types.StorageClass(r.StorageClass)
+	}
+	if r.RTC {
+		threshold := &types.ReplicationTimeValue{Minutes: aws.Int32(rtcMinutes)}
+		rule.Destination.ReplicationTime = &types.ReplicationTime{
+			Status: types.ReplicationTimeStatusEnabled,
+			Time:   threshold,
+		}
+		rule.Destination.Metrics = &types.Metrics{
+			Status:         types.MetricsStatusEnabled,
+			EventThreshold: threshold,
+		}
+	}
+
+	var tags []types.Tag
+	for k, v := range r.Tags {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	switch {
+	case len(tags) == 0:
+		rule.Filter = &types.ReplicationRuleFilter{Prefix: aws.String(r.Prefix)}
+	case len(tags) == 1 && r.Prefix == "":
+		rule.Filter = &types.ReplicationRuleFilter{Tag: &tags[0]}
+	default:
+		rule.Filter = &types.ReplicationRuleFilter{And: &types.ReplicationRuleAndOperator{
+			Prefix: aws.String(r.Prefix),
+			Tags:   tags,
+		}}
+	}
+	return rule
+}
+
+func replicationRuleFromSDK(rule types.ReplicationRule) ReplicationRule {
+	r := ReplicationRule{
+		ID:       aws.ToString(rule.ID),
+		Priority: aws.ToInt32(rule.Priority),
+		Disabled: rule.Status == types.ReplicationRuleStatusDisabled,
+		Prefix:   aws.ToString(rule.Prefix),
+	}
+	if d := rule.DeleteMarkerReplication; d != nil {
+		r.ReplicateDeletes = d.Status == types.DeleteMarkerReplicationStatusEnabled
+	}
+	if d := rule.Destination; d != nil {
+		r.DestinationBucket = strings.TrimPrefix(aws.ToString(d.Bucket), "arn:aws:s3:::")
+		r.StorageClass = string(d.StorageClass)
+		r.RTC = d.ReplicationTime != nil && d.ReplicationTime.Status == types.ReplicationTimeStatusEnabled
+	}
+
+	if f := rule.Filter; f != nil {
+		var tags []types.Tag
+		switch {
+		case f.And != nil:
+			r.Prefix = aws.ToString(f.And.Prefix)
+			tags = f.And.Tags
+		case f.Tag != nil:
+			tags = []types.Tag{*f.Tag}
+		default:
+			r.Prefix = aws.ToString(f.Prefix)
+		}
+		for _, tag := range tags {
+			if r.Tags == nil {
+				r.Tags = make(map[string]string)
+			}
+			r.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+package s3storage
+
+import (
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// opKind groups S3 operations that share a retry policy.
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opDelete
+)
+
+// RetryPolicy configures retries of one kind of operation. Zero fields
+// keep the SDK defaults.
+type RetryPolicy struct {
+	MaxAttempts int
+	MaxBackoff  time.Duration
+}
+
+// RetryPolicies sets separate retry policies for reads (Open, Download,
+// Stat, List...), writes (Save, tagging, multipart) and deletes. Typically
+// reads are retried aggressively, while writes are retried conservatively
+// to avoid hammering a struggling backend with large bodies.
+type RetryPolicies struct {
+	Read   RetryPolicy
+	Write  RetryPolicy
+	Delete RetryPolicy
+}
+
+func (p RetryPolicy) retryer() aws.Retryer {
+	if p == (RetryPolicy{}) {
+		return nil
+	}
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		if p.MaxAttempts > 0 {
+			o.MaxAttempts = p.MaxAttempts
+		}
+		if p.MaxBackoff > 0 {
+			o.MaxBackoff = p.MaxBackoff
+		}
+	})
+}
+
+// optFns returns per-operation client options for an operation of kind.
+func (s *S3Storage) optFns(kind opKind) []func(*s3.Options) {
+	r := s.clients.Load().retryers[kind]
+	if r == nil {
+		return nil
+	}
+	return []func(*s3.Options){func(o *s3.Options) { o.Retryer = r }}
+}
+
+func (s *S3Storage) uploaderOpts(kind opKind) func(*manager.Uploader) {
+	fns := s.optFns(kind)
+	return func(u *manager.Uploader) {
+		u.ClientOptions = append(slices.Clip(u.ClientOptions), fns...)
+	}
+}
+
+func (s *S3Storage) downloaderOpts(kind opKind) func(*manager.Downloader) {
+	fns := s.optFns(kind)
+	return func(d *manager.Downloader) {
+		d.ClientOptions = append(slices.Clip(d.ClientOptions), fns...)
+	}
+}
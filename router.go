@@ -0,0 +1,146 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Route sends keys under Prefix to Storage.
+type Route struct {
+	Prefix  string
+	Storage Storage
+}
+
+// Router is a Storage that maps key prefixes to different storages, e.g.
+// images/ to one bucket and backups/ to another, so the application sees a
+// single namespace. Keys are passed on unchanged and routed by the longest
+// matching prefix. A route with an empty prefix catches everything else.
+type Router struct {
+	routes []Route
+}
+
+var _ Storage = (*Router)(nil)
+
+var errNoRoute = errors.New("no route for key")
+
+// NewRouter creates a Router from routes.
+func NewRouter(routes ...Route) *Router {
+	sorted := append([]Route(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+	return &Router{routes: sorted}
+}
+
+// NewBucketRouter creates a Router with an S3Storage per prefix, e.g.
+//
+//	NewBucketRouter(ctx, map[string]Config{
+//		"images/":  {Bucket: "images", Region: "eu-west-1"},
+//		"backups/": {Bucket: "backups", Region: "eu-central-1"},
+//	})
+func NewBucketRouter(ctx context.Context, routes map[string]Config) (*Router, error) {
+	var rs []Route
+	for prefix, cfg := range routes {
+		st, err := NewS3Storage(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create storage for %q: %w", prefix, err)
+		}
+		rs = append(rs, Route{Prefix: prefix, Storage: st})
+	}
+	return NewRouter(rs...), nil
+}
+
+// route returns the storage for path.
+func (r *Router) route(path string) (Storage, error) {
+	i := r.routeIndex(path)
+	if i < 0 {
+		return nil, fmt.Errorf("%w %s", errNoRoute, path)
+	}
+	return r.routes[i].Storage, nil
+}
+
+func (r *Router) routeIndex(path string) int {
+	for i, rt := range r.routes {
+		if strings.HasPrefix(path, rt.Prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Router) Save(ctx context.Context, path string, body io.Reader, opts ...SaveOption) error {
+	st, err := r.route(path)
+	if err != nil {
+		return err
+	}
+	return st.Save(ctx, path, body, opts...)
+}
+
+func (r *Router) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	st, err := r.route(path)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return st.Open(ctx, path)
+}
+
+func (r *Router) Download(ctx context.Context, path string, w io.WriterAt) error {
+	st, err := r.route(path)
+	if err != nil {
+		return ErrNotFound
+	}
+	return st.Download(ctx, path, w)
+}
+
+func (r *Router) Exists(ctx context.Context, path string) (bool, error) {
+	st, err := r.route(path)
+	if err != nil {
+		return false, nil
+	}
+	return st.Exists(ctx, path)
+}
+
+func (r *Router) Stat(ctx context.Context, path string) (*ObjectInfo, error) {
+	st, err := r.route(path)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return st.Stat(ctx, path)
+}
+
+func (r *Router) Delete(ctx context.Context, path string) error {
+	st, err := r.route(path)
+	if err != nil {
+		return err
+	}
+	return st.Delete(ctx, path)
+}
+
+// List returns objects under prefix from every route that can hold such
+// keys. Keys a route doesn't own, e.g. ones under a longer prefix routed
+// elsewhere, are left out, so each object is reported by its own route.
+func (r *Router) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var merged []ObjectInfo
+	for i, rt := range r.routes {
+		if !strings.HasPrefix(prefix, rt.Prefix) && !strings.HasPrefix(rt.Prefix, prefix) {
+			continue
+		}
+		listPrefix := prefix
+		if len(rt.Prefix) > len(prefix) {
+			listPrefix = rt.Prefix
+		}
+		objects, err := rt.Storage.List(ctx, listPrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			if r.routeIndex(obj.Key) == i {
+				merged = append(merged, obj)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Key < merged[j].Key })
+	return merged, nil
+}
@@ -6,37 +6,150 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
 )
 
-var ErrNotFound = errors.New("file not found")
+// deleteStatAttempts is how many times DeleteAndStat tries when the object
+// is replaced between its Stat and Delete.
+const deleteStatAttempts = 3
+
+var (
+	ErrNotFound           = errors.New("file not found")
+	ErrPreconditionFailed = errors.New("object was changed")
+)
+
+// Storage is the set of operations implemented by S3Storage and by the
+// decorators wrapping it.
+type Storage interface {
+	Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	Download(ctx context.Context, path string, w io.WriterAt) error
+	Exists(ctx context.Context, path string) (bool, error)
+	Delete(ctx context.Context, path string) error
+	Stat(ctx context.Context, path string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+var _ Storage = (*S3Storage)(nil)
 
 type Config struct {
-	Bucket    string
-	Region    string
-	Endpoint  string
-	AccessKey string
-	SecretKey string
+	Bucket   string
+	Region   string
+	Endpoint string
+	// Endpoints lists equivalent gateways to use instead of Endpoint.
+	// Requests are spread round-robin, and endpoints that fail to connect
+	// are skipped for a while, so retries fail over to the others.
+	Endpoints []string
+	// ReadEndpoint, if set, serves reads like Open, Download, Stat and List,
+	// e.g. a read gateway in front of a replica, while all other requests
+	// go to Endpoint. Reads that get no answer or a 5xx one are retried
+	// once against Endpoint; objects not replicated yet are reported
+	// missing. Checks made by write operations always use Endpoint.
+	ReadEndpoint string
+	AccessKey    string
+	SecretKey    string
+	// RetryPolicies sets retries per kind of operation.
+	RetryPolicies RetryPolicies
+	// Transforms are applied to every body on Save and undone on Open
+	// and Download, see Transform.
+	Transforms []Transform
+	// APIOptions are added to the middleware stack of every S3 call, for
+	// things not covered by Config like custom headers or request dumps.
+	APIOptions []func(*middleware.Stack) error
+	// DebugHTTP logs sanitized headers and timing of every S3 request to
+	// Logger at info level. Use WithDebugHTTP to debug single calls.
+	DebugHTTP bool
+	// Logger receives the DebugHTTP output, slog.Default() if nil.
+	Logger *slog.Logger
+	// RequestChecksumWhenRequired only sends checksums for operations that
+	// require them, instead of streaming checksum trailers on every upload.
+	// Some S3-compatible stores reject the trailers with signature errors.
+	RequestChecksumWhenRequired bool
+	// ResponseChecksumWhenRequired only validates response checksums when
+	// the caller asked for them.
+	ResponseChecksumWhenRequired bool
+	// PartSize of multipart uploads and ranged downloads, 5MB by default.
+	// See Benchmark for finding good values.
+	PartSize int64
+	// Concurrency is how many parts are transferred in parallel, 1 by
+	// default to keep memory use low.
+	Concurrency int
+	// ExpectedBucketOwner is the account ID that must own the bucket.
+	// Requests to a bucket of another account fail with access denied
+	// instead of reading or writing someone else's data.
+	ExpectedBucketOwner string
+	// DirectoryMarkers sets how Open and Download treat "folder/" marker
+	// objects. Glob never returns them, List does, see IsDirectoryMarker.
+	DirectoryMarkers MarkerMode
+	// InternalPrefix is where records of the package itself, like shares
+	// and staged transactions, are kept, ".s3storage/" by default. List,
+	// Count, PrefixExists and ExportListing leave them out unless the
+	// listed prefix is inside it.
+	InternalPrefix string
+	// ShareStore keeps share records, e.g. in a separate bucket. By
+	// default they are stored under InternalPrefix.
+	ShareStore StateStore
 }
 
 type S3Storage struct {
 	Bucket     string
+	clients    atomic.Pointer[clients]
+	transforms []Transform
+	markers    MarkerMode
+
+	internalPrefix string
+	shares         StateStore
+
+	flightMu sync.Mutex
+	flights  map[string]*flight
+
+	stats storageStats
+}
+
+// clients are the SDK clients built from one Config. They are swapped as a
+// whole on Reload.
+type clients struct {
 	client     *s3.Client
 	uploader   *manager.Uploader
 	downloader *manager.Downloader
+	retryers   [3]aws.Retryer
+
+	// reader and readDownloader use Config.ReadEndpoint, nil without one.
+	reader         *s3.Client
+	readDownloader *manager.Downloader
+
+	region       string
+	endpoint     string
+	readEndpoint string
+	pool         *endpointPool
 }
 
 type SaveOptions struct {
 	ContentType     string
 	AutoContentType bool
+	Metadata        map[string]string
+	Transforms      []Transform
+	IdempotencyKey  string
+	Deadline        time.Time
+	MaxDuration     time.Duration
 }
 
 type SaveOption func(*SaveOptions)
@@ -53,14 +166,93 @@ func WithAutoContentType() SaveOption {
 	}
 }
 
+// WithMetadata adds a user metadata entry stored with the object.
+func WithMetadata(key, value string) SaveOption {
+	return func(o *SaveOptions) {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string)
+		}
+		o.Metadata[key] = value
+	}
+}
+
 // NewS3Storage creates an S3 storage client
 func NewS3Storage(ctx context.Context, cfg Config) (*S3Storage, error) {
+	c, err := newClients(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &S3Storage{
+		Bucket:         cfg.Bucket,
+		transforms:     cfg.Transforms,
+		markers:        cfg.DirectoryMarkers,
+		internalPrefix: cfg.InternalPrefix,
+		shares:         cfg.ShareStore,
+	}
+	if s.internalPrefix == "" {
+		s.internalPrefix = defaultInternalPrefix
+	}
+	if s.shares == nil {
+		s.shares = NewS3StateStore(s, s.internalKey("shares/"))
+	}
+	s.clients.Store(c)
+	return s, nil
+}
+
+// Reload rebuilds the SDK clients from cfg and atomically replaces the
+// current ones, e.g. after credentials were rotated. Requests already in
+// flight finish with the old clients. The bucket is not changed.
+func (s *S3Storage) Reload(ctx context.Context, cfg Config) error {
+	c, err := newClients(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	s.clients.Store(c)
+	return nil
+}
+
+// ReloadOnSignal calls Reload with a freshly loaded Config whenever one of
+// sigs is received (SIGHUP if none given), until ctx is done. Errors are
+// passed to onError, and the current clients are kept.
+func (s *S3Storage) ReloadOnSignal(ctx context.Context, load func(context.Context) (Config, error), onError func(error), sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
 
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				cfg, err := load(ctx)
+				if err == nil {
+					err = s.Reload(ctx, cfg)
+				}
+				if err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+func newClients(ctx context.Context, cfg Config) (*clients, error) {
 	configOptions := []func(*config.LoadOptions) error{
 		config.WithRegion(cfg.Region),
 		config.WithBaseEndpoint(cfg.Endpoint),
 	}
 
+	if cfg.RequestChecksumWhenRequired {
+		configOptions = append(configOptions, config.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired))
+	}
+	if cfg.ResponseChecksumWhenRequired {
+		configOptions = append(configOptions, config.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired))
+	}
+
 	if cfg.AccessKey != "" && cfg.SecretKey != "" {
 		provider := credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")
 		configOptions = append(configOptions, config.WithCredentialsProvider(provider))
@@ -71,36 +263,116 @@ func NewS3Storage(ctx context.Context, cfg Config) (*S3Storage, error) {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := s3.NewFromConfig(s3cfg)
+	s3cfg.APIOptions = append(s3cfg.APIOptions, cfg.APIOptions...)
+	if cfg.ExpectedBucketOwner != "" {
+		s3cfg.APIOptions = append(s3cfg.APIOptions, withExpectedBucketOwner(cfg.ExpectedBucketOwner))
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	s3cfg.HTTPClient = &debugHTTPClient{always: cfg.DebugHTTP, logger: logger, next: s3cfg.HTTPClient}
+
+	var s3Options []func(*s3.Options)
+	var pool *endpointPool
+	if len(cfg.Endpoints) > 0 {
+		pool, err = newEndpointPool(cfg.Endpoints)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint: %w", err)
+		}
+		s3cfg.HTTPClient = &poolHTTPClient{pool: pool, next: s3cfg.HTTPClient}
+		s3Options = append(s3Options, func(o *s3.Options) {
+			o.EndpointResolverV2 = &poolResolver{pool: pool, next: s3.NewDefaultEndpointResolverV2()}
+		})
+	}
+
+	client := s3.NewFromConfig(s3cfg, s3Options...)
+
+	// Low-memory defaults: 5MB parts, single worker
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = 5 * 1024 * 1024 // minimum allowed by S3 for multipart
+	}
+	concurrency := max(cfg.Concurrency, 1)
 
-	// Configure low-memory upload (5MB part size, single worker)
 	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
-		u.PartSize = 5 * 1024 * 1024 // minimum allowed by S3 for multipart
-		u.Concurrency = 1
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+		// The uploader has its own setting, defaulting to WhenSupported.
+		u.RequestChecksumCalculation = s3cfg.RequestChecksumCalculation
 	})
 
-	// Configure low-memory download (single worker, 5MB parts)
-	downloader := manager.NewDownloader(client, func(d *manager.Downloader) {
-		d.PartSize = 5 * 1024 * 1024
-		d.Concurrency = 1
-	})
+	downloaderOpts := func(d *manager.Downloader) {
+		d.PartSize = partSize
+		d.Concurrency = concurrency
+	}
+	downloader := manager.NewDownloader(client, downloaderOpts)
 
-	return &S3Storage{
-		Bucket:     cfg.Bucket,
+	// The read client goes straight to ReadEndpoint, bypassing the pool.
+	var reader *s3.Client
+	var readDownloader *manager.Downloader
+	if cfg.ReadEndpoint != "" {
+		reader = s3.NewFromConfig(s3cfg, func(o *s3.Options) {
+			o.BaseEndpoint = aws.String(cfg.ReadEndpoint)
+		})
+		readDownloader = manager.NewDownloader(reader, downloaderOpts)
+	}
+
+	return &clients{
 		client:     client,
 		uploader:   uploader,
 		downloader: downloader,
+		retryers: [3]aws.Retryer{
+			opRead:   cfg.RetryPolicies.Read.retryer(),
+			opWrite:  cfg.RetryPolicies.Write.retryer(),
+			opDelete: cfg.RetryPolicies.Delete.retryer(),
+		},
+		reader:         reader,
+		readDownloader: readDownloader,
+		region:         s3cfg.Region,
+		endpoint:       cfg.Endpoint,
+		readEndpoint:   cfg.ReadEndpoint,
+		pool:           pool,
 	}, nil
 }
 
+func (s *S3Storage) client() *s3.Client {
+	return s.clients.Load().client
+}
+
+func (s *S3Storage) uploader() *manager.Uploader {
+	return s.clients.Load().uploader
+}
+
+func (s *S3Storage) downloader() *manager.Downloader {
+	return s.clients.Load().downloader
+}
+
 // Save uploads a file to S3.
 // If contentType is empty, it will be auto-detected from the first 512 bytes.
+// Any io.Reader works, including pipes: the uploader buffers each part in
+// memory before sending it, so failed requests are retried from that copy.
 func (s *S3Storage) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	s.stats.uploads.Add(1)
+	defer s.stats.uploads.Add(-1)
+
 	options := SaveOptions{}
 	for _, opt := range opts {
 		opt(&options)
 	}
 
+	if options.IdempotencyKey != "" {
+		info, err := s.statForWrite(ctx, path)
+		if err == nil && info.Metadata[MetaIdempotencyKey] == options.IdempotencyKey {
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		WithMetadata(MetaIdempotencyKey, options.IdempotencyKey)(&options)
+	}
+
 	if options.ContentType == "" && options.AutoContentType {
 		// Peek first 512 bytes to detect content type
 		buf := make([]byte, 512)
@@ -117,6 +389,16 @@ func (s *S3Storage) Save(ctx context.Context, path string, r io.Reader, opts ...
 		}
 	}
 
+	transforms := s.transforms
+	if options.Transforms != nil {
+		transforms = options.Transforms
+	}
+	if len(transforms) > 0 {
+		pr := encodeChain(r, transforms)
+		defer pr.Close()
+		r = pr
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(path),
@@ -126,56 +408,142 @@ func (s *S3Storage) Save(ctx context.Context, path string, r io.Reader, opts ...
 	if options.ContentType != "" {
 		input.ContentType = aws.String(options.ContentType)
 	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = options.Metadata
+	}
+
+	uploadOpts := []func(*manager.Uploader){s.uploaderOpts(opWrite)}
+	deadline := options.Deadline
+	if options.MaxDuration > 0 {
+		if d := time.Now().Add(options.MaxDuration); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	var body *deadlineReader
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+		// Abort ourselves, the uploader would use the expired context.
+		uploadOpts = append(uploadOpts, func(u *manager.Uploader) { u.LeavePartsOnError = true })
+		body = &deadlineReader{ctx: ctx, r: r}
+		input.Body = body
+	}
 
-	_, err := s.uploader.Upload(ctx, input)
+	_, err := s.uploader().Upload(ctx, input, uploadOpts...)
 	if err != nil {
-		var apiErr smithy.APIError
-		if errors.As(err, &apiErr) {
-			return fmt.Errorf("s3 upload failed for bucket %s, key %s: %s (AWS code: %s): %w",
-				s.Bucket, path, apiErr.ErrorMessage(), apiErr.ErrorCode(), err)
+		if body != nil {
+			err = s.cleanupUpload(ctx, path, err, body.n)
 		}
-		return fmt.Errorf("couldn't upload file %v to %v: %w", path, s.Bucket, err)
+		return s.storageError("save", s.Bucket, path, err)
 	}
 	return nil
 }
 
 // Open returns a ReadCloser for the object. Caller must close it.
 func (s *S3Storage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
-	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(path),
+	return s.OpenTransformed(ctx, path, s.transforms...)
+}
+
+// OpenTransformed is like Open, but undoes the given transforms instead of
+// the ones configured for the storage.
+func (s *S3Storage) OpenTransformed(ctx context.Context, path string, transforms ...Transform) (io.ReadCloser, error) {
+	rc, _, err := s.openObject(ctx, path, transforms)
+	return rc, err
+}
+
+// OpenWithInfo is like Open, but also returns the object's information from
+// the same response, saving the HeadObject request of a separate Stat.
+// With transforms configured Size is -1, as the decoded size isn't known
+// in advance.
+func (s *S3Storage) OpenWithInfo(ctx context.Context, path string) (io.ReadCloser, *ObjectInfo, error) {
+	return s.openObject(ctx, path, s.transforms)
+}
+
+func (s *S3Storage) openObject(ctx context.Context, path string, transforms []Transform) (io.ReadCloser, *ObjectInfo, error) {
+	if err := s.checkMarker("open", path); err != nil {
+		return nil, nil, err
+	}
+	bucket := s.readBucket(ctx)
+	resp, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (*s3.GetObjectOutput, error) {
+		return c.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path),
+		}, s.readOptFns(ctx)...)
 	})
 	if err != nil {
 		var er *types.NoSuchKey
 		if errors.As(err, &er) {
-			return nil, ErrNotFound
+			return nil, nil, s.storageError("open", bucket, path, ErrNotFound)
 		}
-		return nil, fmt.Errorf("failed to open %s from %s: %w", path, s.Bucket, err)
+		return nil, nil, s.storageError("open", bucket, path, err)
+	}
+	info := &ObjectInfo{
+		Key:          path,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ETag:         aws.ToString(resp.ETag),
+		LastModified: aws.ToTime(resp.LastModified),
+		ContentType:  aws.ToString(resp.ContentType),
+		Metadata:     resp.Metadata,
 	}
-	return resp.Body, nil
+	if len(transforms) == 0 {
+		return resp.Body, info, nil
+	}
+	rc, err := decodeChain(resp.Body, transforms)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, s.storageError("open", bucket, path, fmt.Errorf("failed to decode: %w", err))
+	}
+	info.Size = -1
+	return rc, info, nil
 }
 
 // Download streams an S3 object into w.
+// With transforms configured the object is read sequentially through Open.
 func (s *S3Storage) Download(ctx context.Context, path string, w io.WriterAt) error {
-	_, err := s.downloader.Download(ctx, w, &s3.GetObjectInput{
-		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(path),
+	s.stats.downloads.Add(1)
+	defer s.stats.downloads.Add(-1)
+
+	if err := s.checkMarker("download", path); err != nil {
+		return err
+	}
+	bucket := s.readBucket(ctx)
+	if len(s.transforms) > 0 {
+		rc, err := s.Open(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if _, err := io.Copy(io.NewOffsetWriter(w, 0), rc); err != nil {
+			return s.storageError("download", bucket, path, err)
+		}
+		return nil
+	}
+
+	_, err := readFallback(ctx, s, func(_ *s3.Client, d *manager.Downloader) (int64, error) {
+		return d.Download(ctx, w, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path),
+		}, s.readDownloaderOpts(ctx))
 	})
 	if err != nil {
 		var er *types.NoSuchKey
 		if errors.As(err, &er) {
-			return ErrNotFound
+			return s.storageError("download", bucket, path, ErrNotFound)
 		}
-		return fmt.Errorf("failed to download %v from %v: %w", path, s.Bucket, err)
+		return s.storageError("download", bucket, path, err)
 	}
 	return nil
 }
 
 // Exists checks if an object exists in the S3 bucket.
 func (s *S3Storage) Exists(ctx context.Context, path string) (bool, error) {
-	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(path),
+	bucket := s.readBucket(ctx)
+	_, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (*s3.HeadObjectOutput, error) {
+		return c.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path),
+		}, s.readOptFns(ctx)...)
 	})
 	if err == nil {
 		return true, nil
@@ -184,17 +552,140 @@ func (s *S3Storage) Exists(ctx context.Context, path string) (bool, error) {
 	if errors.As(err, &notFound) {
 		return false, nil
 	}
-	return false, fmt.Errorf("failed to check existence of %s in %s: %w", path, s.Bucket, err)
+	return false, s.storageError("exists", bucket, path, err)
+}
+
+// Stat returns information about an object without downloading it.
+func (s *S3Storage) Stat(ctx context.Context, path string) (*ObjectInfo, error) {
+	bucket := s.readBucket(ctx)
+	resp, err := readFallback(ctx, s, func(c *s3.Client, _ *manager.Downloader) (*s3.HeadObjectOutput, error) {
+		return c.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path),
+		}, s.readOptFns(ctx)...)
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, s.storageError("stat", bucket, path, ErrNotFound)
+		}
+		return nil, s.storageError("stat", bucket, path, err)
+	}
+	return &ObjectInfo{
+		Key:          path,
+		Size:         aws.ToInt64(resp.ContentLength),
+		ETag:         aws.ToString(resp.ETag),
+		LastModified: aws.ToTime(resp.LastModified),
+		ContentType:  aws.ToString(resp.ContentType),
+		Metadata:     resp.Metadata,
+	}, nil
+}
+
+// statForWrite is Stat for the checks done by write operations: they look
+// at the configured bucket on the write endpoint, where the write goes,
+// regardless of overrides and of a lagging read endpoint.
+func (s *S3Storage) statForWrite(ctx context.Context, path string) (*ObjectInfo, error) {
+	return s.Stat(withPrimaryReads(withoutOverrides(ctx)), path)
 }
 
 // Delete removes an object from S3.
 func (s *S3Storage) Delete(ctx context.Context, path string) error {
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	_, err := s.client().DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.Bucket),
 		Key:    aws.String(path),
-	})
+	}, s.optFns(opDelete)...)
 	if err != nil {
-		return fmt.Errorf("couldn't delete file %s from %s: %w", path, s.Bucket, err)
+		return s.storageError("delete", s.Bucket, path, err)
 	}
 	return nil
 }
+
+// DeleteAndStat removes an object and returns its information from right
+// before the delete, e.g. for audit logs. The delete is conditional on the
+// ETag, so the returned information describes exactly the deleted object
+// even when it is being overwritten concurrently.
+func (s *S3Storage) DeleteAndStat(ctx context.Context, path string) (*ObjectInfo, error) {
+	for attempt := 1; ; attempt++ {
+		info, err := s.statForWrite(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		err = s.DeleteIfMatch(ctx, path, info.ETag)
+		if errors.Is(err, ErrPreconditionFailed) && attempt < deleteStatAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+}
+
+// DeleteIfMatch removes an object only if its ETag still equals etag, so
+// an object replaced by another writer in the meantime is kept. It returns
+// ErrPreconditionFailed if the ETag differs. Stores without conditional
+// deletes fall back to comparing the ETag with a HEAD request first, which
+// leaves a short window for a concurrent overwrite.
+func (s *S3Storage) DeleteIfMatch(ctx context.Context, path, etag string) error {
+	_, err := s.client().DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:  aws.String(s.Bucket),
+		Key:     aws.String(path),
+		IfMatch: aws.String(etag),
+	}, s.optFns(opDelete)...)
+	if err == nil {
+		return nil
+	}
+	if isPreconditionFailed(err) {
+		return s.storageError("delete", s.Bucket, path, ErrPreconditionFailed)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return s.storageError("delete", s.Bucket, path, ErrNotFound)
+		case "NotImplemented":
+			info, err := s.statForWrite(ctx, path)
+			if err != nil {
+				return err
+			}
+			if strings.Trim(info.ETag, `"`) != strings.Trim(etag, `"`) {
+				return s.storageError("delete", s.Bucket, path, ErrPreconditionFailed)
+			}
+			return s.Delete(ctx, path)
+		}
+	}
+	return s.storageError("delete", s.Bucket, path, err)
+}
+
+// isPreconditionFailed reports whether a conditional request was rejected
+// because the object changed. S3 answers 409 ConditionalRequestConflict
+// instead of 412 when conditional writes race, which means the same.
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode() {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	}
+	return false
+}
+
+// isNoSuchKey reports whether err says the object doesn't exist. Only a few
+// operations have a modeled NoSuchKey error, the others return the code as
+// a generic API error, or just a 404 status.
+func isNoSuchKey(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey":
+			return true
+		case "NoSuchBucket":
+			return false
+		}
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound
+}
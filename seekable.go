@@ -0,0 +1,287 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Constants of the zstd seekable format, see
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+const (
+	seekableSkippableMagic = 0x184D2A5E
+	seekableMagic          = 0x8F92EAB1
+	seekableFooterSize     = 9
+	seekableEntrySize      = 8
+	seekableChecksumFlag   = 1 << 7
+
+	// DefaultSeekableFrameSize is the amount of uncompressed data stored in
+	// each independently decompressible frame.
+	DefaultSeekableFrameSize = 1024 * 1024
+)
+
+var ErrInvalidSeekable = errors.New("object is not in zstd seekable format")
+
+// seekFrame is one entry of the seek table with precomputed offsets.
+type seekFrame struct {
+	compOffset   int64
+	compSize     int64
+	decompOffset int64
+	decompSize   int64
+}
+
+// SaveCompressed compresses r with zstd and stores it in the seekable
+// format, so that ranges of the uncompressed data can later be read with
+// OpenCompressedRange. The result is still a valid zstd stream and can be
+// decompressed as a whole by any zstd decoder.
+func (s *S3Storage) SaveCompressed(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	defer enc.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSeekable(pw, r, enc, DefaultSeekableFrameSize))
+	}()
+	defer pr.Close()
+
+	// Transforms would break the frame offsets stored in the seek table.
+	opts = append([]SaveOption{WithContentType("application/zstd")}, opts...)
+	opts = append(opts, WithTransforms())
+	return s.Save(ctx, path, pr, opts...)
+}
+
+// writeSeekable compresses r into w frame by frame and appends the seek table.
+func writeSeekable(w io.Writer, r io.Reader, enc *zstd.Encoder, frameSize int) error {
+	var table []byte
+	var frames uint32
+	buf := make([]byte, frameSize)
+	var dst []byte
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			dst = enc.EncodeAll(buf[:n], dst[:0])
+			if _, werr := w.Write(dst); werr != nil {
+				return werr
+			}
+			table = binary.LittleEndian.AppendUint32(table, uint32(len(dst)))
+			table = binary.LittleEndian.AppendUint32(table, uint32(n))
+			frames++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	header := make([]byte, 0, 8)
+	header = binary.LittleEndian.AppendUint32(header, seekableSkippableMagic)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(table)+seekableFooterSize))
+
+	footer := make([]byte, 0, seekableFooterSize)
+	footer = binary.LittleEndian.AppendUint32(footer, frames)
+	footer = append(footer, 0) // descriptor: no checksums
+	footer = binary.LittleEndian.AppendUint32(footer, seekableMagic)
+
+	for _, b := range [][]byte{header, table, footer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OpenCompressedRange returns a ReadCloser over length bytes of the
+// uncompressed content of a seekable object, starting at offset. A
+// negative length reads to the end. Only the frames covering the range
+// are fetched from S3. Caller must close it.
+func (s *S3Storage) OpenCompressedRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+
+	frames, err := s.readSeekTable(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if len(frames) > 0 {
+		last := frames[len(frames)-1]
+		total = last.decompOffset + last.decompSize
+	}
+	end := total
+	if length >= 0 && offset+length < total {
+		end = offset + length
+	}
+	if offset >= end {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	frames = coveringFrames(frames, offset, end)
+	compStart := frames[0].compOffset
+	compEnd := frames[len(frames)-1].compOffset + frames[len(frames)-1].compSize
+	body, err := s.openRange(ctx, path, fmt.Sprintf("bytes=%d-%d", compStart, compEnd-1), "")
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+
+	return &seekableRangeReader{
+		body:   body,
+		dec:    dec,
+		frames: frames,
+		skip:   offset - frames[0].decompOffset,
+		remain: end - offset,
+	}, nil
+}
+
+// coveringFrames returns the frames holding the uncompressed bytes from
+// offset up to end, which must be within the object.
+func coveringFrames(frames []seekFrame, offset, end int64) []seekFrame {
+	first := sort.Search(len(frames), func(i int) bool {
+		return frames[i].decompOffset+frames[i].decompSize > offset
+	})
+	last := sort.Search(len(frames), func(i int) bool {
+		return frames[i].decompOffset+frames[i].decompSize >= end
+	})
+	return frames[first : last+1]
+}
+
+// readSeekTable fetches and parses the seek table stored at the end of the object.
+func (s *S3Storage) readSeekTable(ctx context.Context, path string) ([]seekFrame, error) {
+	footer, err := s.readRange(ctx, path, fmt.Sprintf("bytes=-%d", seekableFooterSize), "")
+	if err != nil {
+		return nil, err
+	}
+	tableSize, err := seekTableSize(footer)
+	if err != nil {
+		return nil, err
+	}
+	table, err := s.readRange(ctx, path, fmt.Sprintf("bytes=-%d", tableSize), "")
+	if err != nil {
+		return nil, err
+	}
+	return parseSeekTable(table)
+}
+
+// seekTableSize returns the size of the skippable frame holding the seek
+// table, given the seek table footer.
+func seekTableSize(footer []byte) (int64, error) {
+	if len(footer) != seekableFooterSize || binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return 0, ErrInvalidSeekable
+	}
+	count := int64(binary.LittleEndian.Uint32(footer[0:4]))
+	return 8 + count*seekEntrySize(footer) + seekableFooterSize, nil
+}
+
+func seekEntrySize(footer []byte) int64 {
+	if footer[4]&seekableChecksumFlag != 0 {
+		return seekableEntrySize + 4
+	}
+	return seekableEntrySize
+}
+
+// parseSeekTable parses the skippable frame holding the seek table.
+func parseSeekTable(table []byte) ([]seekFrame, error) {
+	if len(table) < 8+seekableFooterSize || binary.LittleEndian.Uint32(table[0:4]) != seekableSkippableMagic {
+		return nil, ErrInvalidSeekable
+	}
+	footer := table[len(table)-seekableFooterSize:]
+	tableSize, err := seekTableSize(footer)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(table)) != tableSize {
+		return nil, ErrInvalidSeekable
+	}
+
+	count := binary.LittleEndian.Uint32(footer[0:4])
+	entrySize := seekEntrySize(footer)
+	frames := make([]seekFrame, count)
+	var compOffset, decompOffset int64
+	entries := table[8:]
+	for i := range frames {
+		e := entries[int64(i)*entrySize:]
+		frames[i] = seekFrame{
+			compOffset:   compOffset,
+			compSize:     int64(binary.LittleEndian.Uint32(e[0:4])),
+			decompOffset: decompOffset,
+			decompSize:   int64(binary.LittleEndian.Uint32(e[4:8])),
+		}
+		compOffset += frames[i].compSize
+		decompOffset += frames[i].decompSize
+	}
+	return frames, nil
+}
+
+// seekableRangeReader decompresses consecutive frames from body and trims
+// the output to the requested range.
+type seekableRangeReader struct {
+	body   io.ReadCloser
+	dec    *zstd.Decoder
+	frames []seekFrame
+	skip   int64
+	remain int64
+
+	comp []byte
+	out  []byte
+	buf  []byte
+}
+
+func (r *seekableRangeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.remain <= 0 || len(r.frames) == 0 {
+			return 0, io.EOF
+		}
+		f := r.frames[0]
+		r.frames = r.frames[1:]
+
+		if int64(cap(r.comp)) < f.compSize {
+			r.comp = make([]byte, f.compSize)
+		}
+		r.comp = r.comp[:f.compSize]
+		if _, err := io.ReadFull(r.body, r.comp); err != nil {
+			return 0, fmt.Errorf("failed to read compressed frame: %w", err)
+		}
+		out, err := r.dec.DecodeAll(r.comp, r.out[:0])
+		if err != nil {
+			return 0, fmt.Errorf("failed to decompress frame: %w", err)
+		}
+		r.out = out
+		if r.skip > 0 {
+			out = out[min(r.skip, int64(len(out))):]
+			r.skip = 0
+		}
+		if int64(len(out)) > r.remain {
+			out = out[:r.remain]
+		}
+		r.buf = out
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.remain -= int64(n)
+	return n, nil
+}
+
+func (r *seekableRangeReader) Close() error {
+	r.dec.Close()
+	return r.body.Close()
+}
@@ -0,0 +1,189 @@
+package s3storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestSeekTableRoundTrip(t *testing.T) {
+	const frameSize = 1000
+
+	tests := []struct {
+		name       string
+		size       int
+		wantFrames int
+	}{
+		{name: "empty", size: 0, wantFrames: 0},
+		{name: "short frame", size: 10, wantFrames: 1},
+		{name: "exact frames", size: 3 * frameSize, wantFrames: 3},
+		{name: "partial last frame", size: 3*frameSize + 1, wantFrames: 4},
+	}
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			rand.New(rand.NewSource(1)).Read(data[:tt.size/2])
+
+			var buf bytes.Buffer
+			if err := writeSeekable(&buf, bytes.NewReader(data), enc, frameSize); err != nil {
+				t.Fatal(err)
+			}
+			obj := buf.Bytes()
+
+			tableSize, err := seekTableSize(obj[len(obj)-seekableFooterSize:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			frames, err := parseSeekTable(obj[int64(len(obj))-tableSize:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != tt.wantFrames {
+				t.Fatalf("got %d frames, want %d", len(frames), tt.wantFrames)
+			}
+
+			var compOffset, decompOffset int64
+			for i, f := range frames {
+				if f.compOffset != compOffset || f.decompOffset != decompOffset {
+					t.Errorf("frame %d at %d/%d, want %d/%d", i, f.compOffset, f.decompOffset, compOffset, decompOffset)
+				}
+				if f.decompSize != int64(min(frameSize, tt.size-int(decompOffset))) {
+					t.Errorf("frame %d holds %d bytes", i, f.decompSize)
+				}
+				compOffset += f.compSize
+				decompOffset += f.decompSize
+			}
+			if compOffset+tableSize != int64(len(obj)) {
+				t.Errorf("frames end at %d, seek table starts at %d", compOffset, int64(len(obj))-tableSize)
+			}
+
+			// The whole object must stay a valid zstd stream.
+			dec, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dec.Close()
+			got, err := dec.DecodeAll(obj, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Error("decoded object differs from input")
+			}
+		})
+	}
+}
+
+func TestSeekableRangeReader(t *testing.T) {
+	const frameSize = 1000
+
+	data := make([]byte, 3*frameSize+500)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	var buf bytes.Buffer
+	if err := writeSeekable(&buf, bytes.NewReader(data), enc, frameSize); err != nil {
+		t.Fatal(err)
+	}
+	obj := buf.Bytes()
+	tableSize, err := seekTableSize(obj[len(obj)-seekableFooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := parseSeekTable(obj[int64(len(obj))-tableSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		offset     int64
+		end        int64
+		wantFrames int
+	}{
+		{name: "within first frame", offset: 10, end: 20, wantFrames: 1},
+		{name: "frame boundary", offset: frameSize - 5, end: frameSize + 5, wantFrames: 2},
+		{name: "whole frame", offset: frameSize, end: 2 * frameSize, wantFrames: 1},
+		{name: "to the end", offset: 5, end: int64(len(data)), wantFrames: 4},
+		{name: "last byte", offset: int64(len(data)) - 1, end: int64(len(data)), wantFrames: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := coveringFrames(all, tt.offset, tt.end)
+			if len(frames) != tt.wantFrames {
+				t.Fatalf("got %d frames, want %d", len(frames), tt.wantFrames)
+			}
+			compStart := frames[0].compOffset
+			compEnd := frames[len(frames)-1].compOffset + frames[len(frames)-1].compSize
+
+			dec, err := zstd.NewReader(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &seekableRangeReader{
+				body:   io.NopCloser(bytes.NewReader(obj[compStart:compEnd])),
+				dec:    dec,
+				frames: frames,
+				skip:   tt.offset - frames[0].decompOffset,
+				remain: tt.end - tt.offset,
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data[tt.offset:tt.end]) {
+				t.Errorf("got %d bytes differing from data[%d:%d]", len(got), tt.offset, tt.end)
+			}
+		})
+	}
+}
+
+func TestParseSeekTableInvalid(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	var buf bytes.Buffer
+	if err := writeSeekable(&buf, bytes.NewReader(make([]byte, 10)), enc, 4); err != nil {
+		t.Fatal(err)
+	}
+	obj := buf.Bytes()
+	tableSize, err := seekTableSize(obj[len(obj)-seekableFooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := obj[int64(len(obj))-tableSize:]
+
+	tests := []struct {
+		name  string
+		table []byte
+	}{
+		{name: "empty", table: nil},
+		{name: "truncated", table: table[1:]},
+		{name: "plain zstd", table: obj[:len(obj)-int(tableSize)]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSeekTable(tt.table); !errors.Is(err, ErrInvalidSeekable) {
+				t.Errorf("parseSeekTable() = %v, want ErrInvalidSeekable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package s3storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// shareUpdateAttempts bounds retries of the download counter update when
+// the record is changed concurrently.
+const shareUpdateAttempts = 5
+
+var (
+	ErrShareExpired   = errors.New("share link expired")
+	ErrShareExhausted = errors.New("share link download limit reached")
+)
+
+// Share is a revocable download link for one object.
+type Share struct {
+	Token     string    `json:"token"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxDownloads limits the number of downloads, 0 means unlimited.
+	MaxDownloads int `json:"maxDownloads"`
+	Downloads    int `json:"downloads"`
+}
+
+// CreateShare creates a share link for path valid for ttl. Unlike presigned
+// URLs, shares are checked on every download, so they can be revoked and
+// limited to a number of downloads. Serve them with ShareHandler.
+func (s *S3Storage) CreateShare(ctx context.Context, path string, ttl time.Duration, maxDownloads int) (*Share, error) {
+	token := make([]byte, 24)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	share := &Share{
+		Token:        base64.RawURLEncoding.EncodeToString(token),
+		Path:         path,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(ttl),
+		MaxDownloads: maxDownloads,
+	}
+	if err := s.putShare(ctx, share, ""); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetShare returns the share record for token.
+func (s *S3Storage) GetShare(ctx context.Context, token string) (*Share, error) {
+	share, _, err := s.getShare(ctx, token)
+	return share, err
+}
+
+// RevokeShare invalidates a share link immediately.
+func (s *S3Storage) RevokeShare(ctx context.Context, token string) error {
+	if !validShareToken(token) {
+		return ErrNotFound
+	}
+	return s.shares.Delete(ctx, token)
+}
+
+// ShareHandler serves shared objects at <mount point>/<token>. It checks
+// expiry and the download limit, counts the download and streams the object.
+func (s *S3Storage) ShareHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		share, err := s.claimShareDownload(r.Context(), path.Base(r.URL.Path))
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.NotFound(w, r)
+			return
+		case errors.Is(err, ErrShareExpired), errors.Is(err, ErrShareExhausted):
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		case err != nil:
+			http.Error(w, "failed to load share", http.StatusBadGateway)
+			return
+		}
+
+		info, err := s.Stat(r.Context(), share.Path)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, "failed to open shared object", http.StatusBadGateway)
+			return
+		}
+		rc, err := s.Open(r.Context(), share.Path)
+		if err != nil {
+			http.Error(w, "failed to open shared object", http.StatusBadGateway)
+			return
+		}
+		defer rc.Close()
+
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		filename := OriginalFilename(info)
+		if filename == "" {
+			filename = path.Base(share.Path)
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		io.Copy(w, rc)
+	})
+}
+
+// claimShareDownload validates a share and increments its download counter.
+// The counter is updated with a conditional write, so concurrent downloads
+// can't exceed the limit.
+func (s *S3Storage) claimShareDownload(ctx context.Context, token string) (*Share, error) {
+	for attempt := 0; attempt < shareUpdateAttempts; attempt++ {
+		share, etag, err := s.getShare(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().After(share.ExpiresAt) {
+			return nil, ErrShareExpired
+		}
+		if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+			return nil, ErrShareExhausted
+		}
+
+		share.Downloads++
+		err = s.putShare(ctx, share, etag)
+		if errors.Is(err, ErrPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return share, nil
+	}
+	return nil, fmt.Errorf("share %s is updated concurrently, giving up", token)
+}
+
+// getShare returns the share record for token and its version in the
+// share store.
+func (s *S3Storage) getShare(ctx context.Context, token string) (*Share, string, error) {
+	if !validShareToken(token) {
+		return nil, "", ErrNotFound
+	}
+	data, version, err := s.shares.Load(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var share Share
+	if err := json.Unmarshal(data, &share); err != nil {
+		return nil, "", fmt.Errorf("failed to decode share %s: %w", token, err)
+	}
+	return &share, version, nil
+}
+
+// putShare stores a share record. With an empty version the record must
+// be new, otherwise the write only succeeds if the record wasn't changed
+// since it was read.
+func (s *S3Storage) putShare(ctx context.Context, share *Share, version string) error {
+	data, err := json.Marshal(share)
+	if err != nil {
+		return fmt.Errorf("failed to encode share: %w", err)
+	}
+	_, err = s.shares.Store(ctx, share.Token, data, version)
+	return err
+}
+
+func validShareToken(token string) bool {
+	return token != "" && !strings.ContainsAny(token, "/.")
+}
@@ -0,0 +1,54 @@
+package s3storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// spooled is a seekable copy of a body. Close removes the temporary file.
+type spooled struct {
+	io.ReadSeeker
+	file *os.File
+}
+
+func (s *spooled) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return errors.Join(s.file.Close(), os.Remove(s.file.Name()))
+}
+
+// spool reads r into memory, switching to a temporary file in dir once
+// more than memLimit bytes were read.
+func spool(r io.Reader, memLimit int64, dir string) (*spooled, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, memLimit+1)
+	if err == io.EOF {
+		return &spooled{ReadSeeker: bytes.NewReader(buf.Bytes())}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to spool body: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "s3storage-spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	sp := &spooled{ReadSeeker: f, file: f}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		sp.Close()
+		return nil, fmt.Errorf("failed to spool body: %w", err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		sp.Close()
+		return nil, fmt.Errorf("failed to spool body: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		sp.Close()
+		return nil, fmt.Errorf("failed to spool body: %w", err)
+	}
+	return sp, nil
+}
@@ -0,0 +1,98 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// StateStore keeps small records shared by cooperating processes. Writes
+// are compare-and-swap on an opaque version, so concurrent updates of the
+// same record can't overwrite each other.
+type StateStore interface {
+	// Load returns the record at key and its version, or ErrNotFound.
+	Load(ctx context.Context, key string) (data []byte, version string, err error)
+	// Store writes the record at key if its version is still version, or,
+	// with an empty version, if it doesn't exist yet. Otherwise it fails
+	// with ErrPreconditionFailed. Returns the new version.
+	Store(ctx context.Context, key string, data []byte, version string) (string, error)
+	// Delete removes the record at key. Missing records are not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// S3StateStore is a StateStore keeping records as objects under a prefix,
+// using ETags and conditional writes as versions.
+type S3StateStore struct {
+	storage *S3Storage
+	prefix  string
+}
+
+var _ StateStore = (*S3StateStore)(nil)
+
+// NewS3StateStore creates a StateStore in the bucket of s. The provider
+// must support conditional writes (If-Match and If-None-Match on PUT).
+func NewS3StateStore(s *S3Storage, prefix string) *S3StateStore {
+	return &S3StateStore{storage: s, prefix: prefix}
+}
+
+func (st *S3StateStore) Load(ctx context.Context, key string) ([]byte, string, error) {
+	s := st.storage
+	resp, err := s.client().GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(st.prefix + key),
+	}, s.optFns(opRead)...)
+	if err != nil {
+		var er *types.NoSuchKey
+		if errors.As(err, &er) {
+			return nil, "", s.storageError("load state", s.Bucket, st.prefix+key, ErrNotFound)
+		}
+		return nil, "", s.storageError("load state", s.Bucket, st.prefix+key, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", s.storageError("load state", s.Bucket, st.prefix+key, err)
+	}
+	return data, aws.ToString(resp.ETag), nil
+}
+
+func (st *S3StateStore) Store(ctx context.Context, key string, data []byte, version string) (string, error) {
+	s := st.storage
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(st.prefix + key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}
+	if version != "" {
+		input.IfMatch = aws.String(version)
+	} else {
+		input.IfNoneMatch = aws.String("*")
+	}
+	resp, err := s.client().PutObject(ctx, input, s.optFns(opWrite)...)
+	if err != nil {
+		if isPreconditionFailed(err) {
+			return "", s.storageError("store state", s.Bucket, st.prefix+key, ErrPreconditionFailed)
+		}
+		return "", s.storageError("store state", s.Bucket, st.prefix+key, err)
+	}
+	return aws.ToString(resp.ETag), nil
+}
+
+func (st *S3StateStore) Delete(ctx context.Context, key string) error {
+	s := st.storage
+	_, err := s.client().DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(st.prefix + key),
+	}, s.optFns(opDelete)...)
+	if err != nil {
+		return s.storageError("delete state", s.Bucket, st.prefix+key, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package s3storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statusSlots one-minute slots make up the window of StorageStatus.RecentErrors.
+const statusSlots = 5
+
+// StorageStatus is a snapshot of the storage state for debug and readiness
+// endpoints.
+type StorageStatus struct {
+	Bucket       string
+	Region       string
+	Endpoint     string
+	ReadEndpoint string
+	Endpoints    []EndpointStatus
+	Transforms   int
+	// RecentErrors counts failed operations of the last five minutes by
+	// ErrorCode name. Not found errors are included.
+	RecentErrors      map[string]int64
+	InFlightUploads   int64
+	InFlightDownloads int64
+	// CacheHits and CacheMisses count block lookups of all ReaderAts.
+	CacheHits    int64
+	CacheMisses  int64
+	CacheHitRate float64
+}
+
+// EndpointStatus is the health of one endpoint from Config.Endpoints.
+// Endpoints that failed to connect are skipped until DownUntil.
+type EndpointStatus struct {
+	URL       string
+	Healthy   bool
+	DownUntil time.Time
+}
+
+// storageStats collects the counters reported by Status. The zero value
+// is ready to use.
+type storageStats struct {
+	uploads     atomic.Int64
+	downloads   atomic.Int64
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+
+	mu     sync.Mutex
+	errors [statusSlots]errorSlot
+}
+
+type errorSlot struct {
+	start  time.Time
+	counts map[ErrorCode]int64
+}
+
+func (st *storageStats) recordError(code ErrorCode) {
+	start := time.Now().Truncate(time.Minute)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	slot := &st.errors[start.Unix()/60%statusSlots]
+	if !slot.start.Equal(start) {
+		slot.start = start
+		slot.counts = make(map[ErrorCode]int64)
+	}
+	slot.counts[code]++
+}
+
+func (st *storageStats) recentErrors() map[string]int64 {
+	cutoff := time.Now().Truncate(time.Minute).Add(-(statusSlots - 1) * time.Minute)
+	counts := make(map[string]int64)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, slot := range st.errors {
+		if slot.start.Before(cutoff) {
+			continue
+		}
+		for code, n := range slot.counts {
+			counts[code.String()] += n
+		}
+	}
+	return counts
+}
+
+// Status returns the current configuration summary, recent errors,
+// endpoint health, transfers in progress and ReaderAt cache statistics.
+func (s *S3Storage) Status() StorageStatus {
+	c := s.clients.Load()
+	status := StorageStatus{
+		Bucket:            s.Bucket,
+		Region:            c.region,
+		Endpoint:          c.endpoint,
+		ReadEndpoint:      c.readEndpoint,
+		Transforms:        len(s.transforms),
+		RecentErrors:      s.stats.recentErrors(),
+		InFlightUploads:   s.stats.uploads.Load(),
+		InFlightDownloads: s.stats.downloads.Load(),
+		CacheHits:         s.stats.cacheHits.Load(),
+		CacheMisses:       s.stats.cacheMisses.Load(),
+	}
+	if total := status.CacheHits + status.CacheMisses; total > 0 {
+		status.CacheHitRate = float64(status.CacheHits) / float64(total)
+	}
+
+	if c.pool != nil {
+		now := time.Now()
+		for _, e := range c.pool.endpoints {
+			e.mu.Lock()
+			es := EndpointStatus{URL: e.url, Healthy: now.After(e.downUntil)}
+			if !es.Healthy {
+				es.DownUntil = e.downUntil
+			}
+			e.mu.Unlock()
+			status.Endpoints = append(status.Endpoints, es)
+		}
+	}
+	return status
+}
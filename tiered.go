@@ -0,0 +1,258 @@
+package s3storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type TieredConfig struct {
+	// After is how long an object stays in the hot tier after its last write.
+	After time.Duration
+	// Prefix limits migration to keys under it.
+	Prefix string
+	// Interval between migration runs started by Run.
+	Interval time.Duration
+	// OnError is called for objects that failed to migrate.
+	OnError func(key string, err error)
+	// Candidates, if set, selects the objects to migrate instead of the
+	// age of their last write, e.g. S3Storage.ColdCandidates of the hot tier.
+	Candidates func(ctx context.Context, prefix string, olderThan time.Duration) ([]ObjectInfo, error)
+}
+
+// Tiered is a Storage that writes to a hot backend and moves objects to a
+// cold backend once they are older than the configured window. Reads try
+// the hot tier first and fall back to the cold one, so callers don't need
+// to know where an object lives.
+type Tiered struct {
+	hot  Storage
+	cold Storage
+	cfg  TieredConfig
+}
+
+var _ Storage = (*Tiered)(nil)
+
+// NewTiered creates a tiered storage. Start the migration worker with Run.
+func NewTiered(hot, cold Storage, cfg TieredConfig) *Tiered {
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+	return &Tiered{hot: hot, cold: cold, cfg: cfg}
+}
+
+func (t *Tiered) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	return t.hot.Save(ctx, path, r, opts...)
+}
+
+func (t *Tiered) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	rc, err := t.hot.Open(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return t.cold.Open(ctx, path)
+	}
+	return rc, err
+}
+
+func (t *Tiered) Download(ctx context.Context, path string, w io.WriterAt) error {
+	err := t.hot.Download(ctx, path, w)
+	if errors.Is(err, ErrNotFound) {
+		return t.cold.Download(ctx, path, w)
+	}
+	return err
+}
+
+func (t *Tiered) Exists(ctx context.Context, path string) (bool, error) {
+	ok, err := t.hot.Exists(ctx, path)
+	if err != nil || ok {
+		return ok, err
+	}
+	return t.cold.Exists(ctx, path)
+}
+
+func (t *Tiered) Stat(ctx context.Context, path string) (*ObjectInfo, error) {
+	info, err := t.hot.Stat(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return t.cold.Stat(ctx, path)
+	}
+	return info, err
+}
+
+// Delete removes the object from both tiers.
+func (t *Tiered) Delete(ctx context.Context, path string) error {
+	if err := t.hot.Delete(ctx, path); err != nil {
+		return err
+	}
+	return t.cold.Delete(ctx, path)
+}
+
+// List returns objects from both tiers. An object present in both, which
+// happens during migration, is reported once with its hot tier info.
+func (t *Tiered) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	hot, err := t.hot.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := t.cold.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(hot))
+	for _, obj := range hot {
+		seen[obj.Key] = true
+	}
+	merged := hot
+	for _, obj := range cold {
+		if !seen[obj.Key] {
+			merged = append(merged, obj)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Key < merged[j].Key })
+	return merged, nil
+}
+
+// Run migrates objects every Interval until ctx is done.
+func (t *Tiered) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		t.Migrate(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Migrate moves all hot objects older than the window to the cold tier and
+// returns how many were moved. Objects rewritten while being moved are
+// left in the hot tier for a later run. Failures of single objects are
+// reported to OnError and don't stop the run.
+func (t *Tiered) Migrate(ctx context.Context) (int, error) {
+	var objects []ObjectInfo
+	var err error
+	if t.cfg.Candidates != nil {
+		objects, err = t.cfg.Candidates(ctx, t.cfg.Prefix, t.cfg.After)
+	} else {
+		objects, err = t.hot.List(ctx, t.cfg.Prefix)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-t.cfg.After)
+	moved := 0
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			return moved, ctx.Err()
+		}
+		if obj.LastModified.After(cutoff) {
+			continue
+		}
+		ok, err := t.move(ctx, obj.Key)
+		if err != nil {
+			if t.cfg.OnError != nil {
+				t.cfg.OnError(obj.Key, err)
+			}
+			continue
+		}
+		if ok {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// conditionalDeleter is implemented by storages that can delete an object
+// only if it wasn't rewritten, like S3Storage.
+type conditionalDeleter interface {
+	DeleteIfMatch(ctx context.Context, path, etag string) error
+}
+
+// move copies one object to the cold tier, reads the copy back to check it
+// and removes the hot one. If the hot object is rewritten meanwhile it stays
+// in the hot tier and the move is skipped, reads prefer the hot tier anyway.
+func (t *Tiered) move(ctx context.Context, key string) (bool, error) {
+	// Read both tiers where they are written, a replica behind a read
+	// endpoint may not have the latest version or the fresh cold copy.
+	ctx = withPrimaryReads(ctx)
+	info, err := t.hot.Stat(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	rc, err := t.hot.Open(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	opts := []SaveOption{WithContentType(info.ContentType)}
+	for k, v := range info.Metadata {
+		opts = append(opts, WithMetadata(k, v))
+	}
+	// Count the content, not the stored size: tiers with different
+	// Transforms store the same content with different sizes.
+	src := &countingReader{r: rc}
+	if err := t.cold.Save(ctx, key, src, opts...); err != nil {
+		return false, err
+	}
+	copied, err := t.contentSize(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if copied != src.n {
+		return false, fmt.Errorf("cold copy of %s has %d bytes, expected %d", key, copied, src.n)
+	}
+
+	err = t.deleteHot(ctx, key, info.ETag)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// deleteHot deletes the hot object unless its ETag changed. Hot storages
+// without conditional deletes are checked with Stat right before, which
+// leaves a much smaller window for a concurrent write to be lost.
+func (t *Tiered) deleteHot(ctx context.Context, key, etag string) error {
+	if d, ok := t.hot.(conditionalDeleter); ok {
+		return d.DeleteIfMatch(ctx, key, etag)
+	}
+	info, err := t.hot.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if info.ETag != etag {
+		return ErrPreconditionFailed
+	}
+	return t.hot.Delete(ctx, key)
+}
+
+// contentSize reads the cold copy of key back and returns its length.
+func (t *Tiered) contentSize(ctx context.Context, key string) (int64, error) {
+	rc, err := t.cold.Open(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.Copy(io.Discard, rc)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cold copy of %s: %w", key, err)
+	}
+	return n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,108 @@
+package s3storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Transform is one step of a body transformation chain, e.g. compression
+// or encryption. On Save the steps are applied in order, so with
+// [compress, encrypt] the data is compressed first and the result
+// encrypted. On read they are undone in reverse order.
+type Transform interface {
+	// Encode returns a writer that transforms data and writes it to w.
+	// Closing it must flush, but not close w.
+	Encode(w io.Writer) (io.WriteCloser, error)
+	// Decode returns a reader that undoes the transformation of r.
+	Decode(r io.Reader) (io.ReadCloser, error)
+}
+
+// WithTransforms sets the transforms for one Save, replacing the ones
+// configured for the storage. Without arguments, the body is stored as is.
+func WithTransforms(transforms ...Transform) SaveOption {
+	return func(o *SaveOptions) {
+		o.Transforms = append([]Transform{}, transforms...)
+	}
+}
+
+// GzipTransform compresses bodies with gzip.
+type GzipTransform struct {
+	Level int
+}
+
+func (t GzipTransform) Encode(w io.Writer) (io.WriteCloser, error) {
+	level := t.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+func (t GzipTransform) Decode(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// encodeChain returns a reader producing r passed through all transforms.
+// The caller must close it to stop the encoding goroutine.
+func encodeChain(r io.Reader, transforms []Transform) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encodeTo(pw, r, transforms))
+	}()
+	return pr
+}
+
+func encodeTo(dst io.Writer, r io.Reader, transforms []Transform) error {
+	writers := make([]io.WriteCloser, len(transforms))
+	w := dst
+	for i := len(transforms) - 1; i >= 0; i-- {
+		wc, err := transforms[i].Encode(w)
+		if err != nil {
+			return fmt.Errorf("failed to start transform: %w", err)
+		}
+		writers[i] = wc
+		w = wc
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	// Close outermost first so every step flushes into the next one.
+	for _, wc := range writers {
+		if err := wc.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeChain undoes transforms on body. Closing the result closes body.
+func decodeChain(body io.ReadCloser, transforms []Transform) (io.ReadCloser, error) {
+	closers := []io.Closer{body}
+	var r io.Reader = body
+	for i := len(transforms) - 1; i >= 0; i-- {
+		rc, err := transforms[i].Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, rc)
+		r = rc
+	}
+	return &chainReader{Reader: r, closers: closers}, nil
+}
+
+type chainReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (c *chainReader) Close() error {
+	var err error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if cerr := c.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// stagingDir is where transactions keep their objects until commit,
+// relative to the internal prefix.
+const stagingDir = "staging/"
+
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx stages writes under a temporary prefix so that a set of objects
+// appears together. Commit writes a manifest first: once it exists the
+// transaction counts as committed, and RecoverTxs can finish copying if
+// the committing process dies. Readers may still observe a partially
+// copied set for the duration of Commit.
+type Tx struct {
+	s  *S3Storage
+	id string
+
+	mu    sync.Mutex
+	paths []string
+	done  bool
+}
+
+type txManifest struct {
+	Paths []string `json:"paths"`
+}
+
+// BeginTx starts a staging transaction.
+func (s *S3Storage) BeginTx(ctx context.Context) (*Tx, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate transaction id: %w", err)
+	}
+	return &Tx{s: s, id: hex.EncodeToString(id)}, nil
+}
+
+// Save stages an object to be written to path on Commit.
+func (tx *Tx) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return ErrTxDone
+	}
+	tx.mu.Unlock()
+
+	if err := tx.s.Save(ctx, tx.s.txDataKey(tx.id, path), r, opts...); err != nil {
+		return err
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.paths = append(tx.paths, path)
+	return nil
+}
+
+// Commit copies all staged objects into place and removes the staging area.
+func (tx *Tx) Commit(ctx context.Context) error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return ErrTxDone
+	}
+	tx.done = true
+	paths := tx.paths
+	tx.mu.Unlock()
+
+	data, err := json.Marshal(txManifest{Paths: paths})
+	if err != nil {
+		return fmt.Errorf("failed to encode transaction manifest: %w", err)
+	}
+	// Save reports the manifest key, which names the transaction.
+	err = tx.s.Save(ctx, tx.s.txManifestKey(tx.id), bytes.NewReader(data), WithContentType("application/json"), WithTransforms())
+	if err != nil {
+		return err
+	}
+	return tx.s.applyTx(ctx, tx.id, paths)
+}
+
+// Rollback discards all staged objects.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.mu.Unlock()
+
+	return tx.s.deletePrefix(ctx, tx.s.txDir(tx.id))
+}
+
+// RecoverTxs finishes transactions whose commit was interrupted. Staging
+// areas without a manifest belong to running or abandoned transactions and
+// are left alone.
+func (s *S3Storage) RecoverTxs(ctx context.Context) error {
+	staging := s.internalKey(stagingDir)
+	objects, err := s.List(ctx, staging)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(obj.Key, staging), "/manifest.json")
+		if !ok || strings.Contains(id, "/") {
+			continue
+		}
+
+		rc, err := s.OpenTransformed(ctx, obj.Key)
+		if err != nil {
+			return err
+		}
+		var manifest txManifest
+		err = json.NewDecoder(rc).Decode(&manifest)
+		rc.Close()
+		if err != nil {
+			return s.storageError("recover transaction", s.Bucket, obj.Key, fmt.Errorf("failed to decode manifest: %w", err))
+		}
+		if err := s.applyTx(ctx, id, manifest.Paths); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTx copies staged objects into place and removes the staging area.
+// Objects that were already moved by an earlier attempt are skipped.
+func (s *S3Storage) applyTx(ctx context.Context, id string, paths []string) error {
+	for _, path := range paths {
+		err := s.copyObject(ctx, s.txDataKey(id, path), path)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := s.Delete(ctx, s.txDataKey(id, path)); err != nil {
+			return err
+		}
+	}
+	return s.deletePrefix(ctx, s.txDir(id))
+}
+
+// copyObject copies an object within the bucket on the server side.
+// S3 limits single copies to 5GB.
+func (s *S3Storage) copyObject(ctx context.Context, src, dst string) error {
+	source := (&url.URL{Path: s.Bucket + "/" + src}).EscapedPath()
+	_, err := s.client().CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.Bucket),
+		Key:        aws.String(dst),
+		CopySource: aws.String(source),
+	}, s.optFns(opWrite)...)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return s.storageError("copy", s.Bucket, src, ErrNotFound)
+		}
+		return s.storageError("copy", s.Bucket, dst, fmt.Errorf("from %s: %w", src, err))
+	}
+	return nil
+}
+
+// deletePrefix removes all objects under prefix.
+func (s *S3Storage) deletePrefix(ctx context.Context, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txDir returns the staging area of transaction id.
+func (s *S3Storage) txDir(id string) string {
+	return s.internalKey(stagingDir + id + "/")
+}
+
+func (s *S3Storage) txDataKey(id, path string) string {
+	return s.txDir(id) + "data/" + path
+}
+
+func (s *S3Storage) txManifestKey(id string) string {
+	return s.txDir(id) + "manifest.json"
+}
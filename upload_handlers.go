@@ -0,0 +1,222 @@
+package s3storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const maxUploadParts = 10000
+
+type UploadHandlerConfig struct {
+	// KeyFunc decides where a new upload is stored. Returning an error
+	// rejects the upload with 403.
+	KeyFunc func(r *http.Request, filename string) (string, error)
+	// Authorize is called for part and complete requests, so that only
+	// the owner can continue an upload. Optional.
+	Authorize func(r *http.Request, key string) error
+	// PartURLExpiry is how long a presigned part URL stays valid.
+	PartURLExpiry time.Duration
+}
+
+// UploadHandlers exposes S3 multipart uploads to browsers. The client
+// initiates an upload, asks for a presigned URL for every part, PUTs the
+// part directly to S3, and finally completes the upload with the ETags it
+// received. All requests and responses are JSON.
+type UploadHandlers struct {
+	s   *S3Storage
+	cfg UploadHandlerConfig
+}
+
+// NewUploadHandlers creates the browser multipart upload handlers.
+func (s *S3Storage) NewUploadHandlers(cfg UploadHandlerConfig) *UploadHandlers {
+	if cfg.PartURLExpiry == 0 {
+		cfg.PartURLExpiry = 15 * time.Minute
+	}
+	return &UploadHandlers{s: s, cfg: cfg}
+}
+
+type initiateUploadRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+}
+
+type uploadRef struct {
+	Key      string `json:"key"`
+	UploadID string `json:"uploadId"`
+}
+
+type partRequest struct {
+	uploadRef
+	PartNumber int32 `json:"partNumber"`
+}
+
+type partResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type completedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+type completeRequest struct {
+	uploadRef
+	Parts []completedPart `json:"parts"`
+}
+
+type completeResponse struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag"`
+}
+
+// InitiateUploadHandler starts a multipart upload and responds with its key and upload ID.
+func (h *UploadHandlers) InitiateUploadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req initiateUploadRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		key, err := h.cfg.KeyFunc(r, req.Filename)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		input := &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(h.s.Bucket),
+			Key:    aws.String(key),
+		}
+		if req.ContentType != "" {
+			input.ContentType = aws.String(req.ContentType)
+		}
+		resp, err := h.s.client().CreateMultipartUpload(r.Context(), input, h.s.optFns(opWrite)...)
+		if err != nil {
+			http.Error(w, "failed to initiate upload", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, uploadRef{Key: key, UploadID: aws.ToString(resp.UploadId)})
+	})
+}
+
+// PartHandler responds with a presigned URL for uploading one part.
+func (h *UploadHandlers) PartHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req partRequest
+		if !decodeJSON(w, r, &req) || !h.authorize(w, r, req.uploadRef) {
+			return
+		}
+		if req.PartNumber < 1 || req.PartNumber > maxUploadParts {
+			http.Error(w, fmt.Sprintf("part number must be between 1 and %d", maxUploadParts), http.StatusBadRequest)
+			return
+		}
+
+		signed, err := s3.NewPresignClient(h.s.client()).PresignUploadPart(r.Context(), &s3.UploadPartInput{
+			Bucket:     aws.String(h.s.Bucket),
+			Key:        aws.String(req.Key),
+			UploadId:   aws.String(req.UploadID),
+			PartNumber: aws.Int32(req.PartNumber),
+		}, s3.WithPresignExpires(h.cfg.PartURLExpiry))
+		if err != nil {
+			http.Error(w, "failed to sign part", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, partResponse{URL: signed.URL, ExpiresAt: time.Now().Add(h.cfg.PartURLExpiry)})
+	})
+}
+
+// CompleteHandler assembles the uploaded parts into the final object.
+func (h *UploadHandlers) CompleteHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completeRequest
+		if !decodeJSON(w, r, &req) || !h.authorize(w, r, req.uploadRef) {
+			return
+		}
+		if len(req.Parts) == 0 {
+			http.Error(w, "no parts", http.StatusBadRequest)
+			return
+		}
+
+		parts := make([]types.CompletedPart, len(req.Parts))
+		for i, p := range req.Parts {
+			parts[i] = types.CompletedPart{
+				PartNumber: aws.Int32(p.PartNumber),
+				ETag:       aws.String(p.ETag),
+			}
+		}
+		resp, err := h.s.client().CompleteMultipartUpload(r.Context(), &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(h.s.Bucket),
+			Key:             aws.String(req.Key),
+			UploadId:        aws.String(req.UploadID),
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		}, h.s.optFns(opWrite)...)
+		if err != nil {
+			var apiErr *types.NoSuchUpload
+			if errors.As(err, &apiErr) {
+				http.Error(w, "no such upload", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "failed to complete upload", http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, completeResponse{Key: req.Key, ETag: aws.ToString(resp.ETag)})
+	})
+}
+
+// AbortHandler cancels an upload and frees the parts stored so far.
+func (h *UploadHandlers) AbortHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req uploadRef
+		if !decodeJSON(w, r, &req) || !h.authorize(w, r, req) {
+			return
+		}
+		_, err := h.s.client().AbortMultipartUpload(r.Context(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(h.s.Bucket),
+			Key:      aws.String(req.Key),
+			UploadId: aws.String(req.UploadID),
+		}, h.s.optFns(opWrite)...)
+		if err != nil {
+			http.Error(w, "failed to abort upload", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (h *UploadHandlers) authorize(w http.ResponseWriter, r *http.Request, ref uploadRef) bool {
+	if ref.Key == "" || ref.UploadID == "" {
+		http.Error(w, "key and uploadId are required", http.StatusBadRequest)
+		return false
+	}
+	if h.cfg.Authorize != nil {
+		if err := h.cfg.Authorize(r, ref.Key); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(v); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,162 @@
+package s3storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// versionUpdateAttempts bounds retries of the latest pointer update when
+// it is changed concurrently.
+const versionUpdateAttempts = 10
+
+// Version is one immutable snapshot written by SaveVersioned.
+type Version struct {
+	Number int
+	ObjectInfo
+}
+
+// versionPointer is stored at <basePath>/latest. Next reserves version
+// numbers, Latest points at the newest version that was fully written.
+type versionPointer struct {
+	Latest int `json:"latest"`
+	Next   int `json:"next"`
+}
+
+// SaveVersioned stores r as a new immutable version at <basePath>/v<N> and
+// moves the <basePath>/latest pointer to it. It is meant for buckets with
+// S3 versioning turned off. Concurrent writers get distinct version numbers,
+// and the pointer never moves back to an older version. Returns the key
+// the version was written to.
+func (s *S3Storage) SaveVersioned(ctx context.Context, basePath string, r io.Reader, opts ...SaveOption) (string, error) {
+	n, err := s.updateVersionPointer(ctx, basePath, func(p *versionPointer) bool {
+		p.Next++
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	key := versionKey(basePath, n.Next)
+	if err := s.Save(ctx, key, r, opts...); err != nil {
+		return "", err
+	}
+
+	_, err = s.updateVersionPointer(ctx, basePath, func(p *versionPointer) bool {
+		if p.Latest >= n.Next {
+			return false
+		}
+		p.Latest = n.Next
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// LatestVersion returns the key of the newest version of basePath.
+func (s *S3Storage) LatestVersion(ctx context.Context, basePath string) (string, error) {
+	p, _, err := s.getVersionPointer(ctx, basePath)
+	if err != nil {
+		return "", err
+	}
+	if p.Latest == 0 {
+		return "", ErrNotFound
+	}
+	return versionKey(basePath, p.Latest), nil
+}
+
+// ListVersionsOf returns all versions of basePath, oldest first.
+func (s *S3Storage) ListVersionsOf(ctx context.Context, basePath string) ([]Version, error) {
+	prefix := strings.TrimSuffix(basePath, "/") + "/v"
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for _, obj := range objects {
+		n, err := strconv.Atoi(strings.TrimPrefix(obj.Key, prefix))
+		if err != nil || n <= 0 {
+			continue
+		}
+		versions = append(versions, Version{Number: n, ObjectInfo: obj})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	return versions, nil
+}
+
+// updateVersionPointer applies update to the pointer of basePath with a
+// conditional write, retrying when it was changed concurrently. If update
+// returns false the pointer is left as is.
+func (s *S3Storage) updateVersionPointer(ctx context.Context, basePath string, update func(*versionPointer) bool) (*versionPointer, error) {
+	for attempt := 0; attempt < versionUpdateAttempts; attempt++ {
+		p, etag, err := s.getVersionPointer(ctx, basePath)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		if !update(p) {
+			return p, nil
+		}
+		err = s.putVersionPointer(ctx, basePath, p, etag)
+		if errors.Is(err, ErrPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("version pointer of %s is updated concurrently, giving up", basePath)
+}
+
+// getVersionPointer returns the pointer of basePath and its version. A
+// missing pointer is returned as a zero value along with ErrNotFound.
+func (s *S3Storage) getVersionPointer(ctx context.Context, basePath string) (*versionPointer, string, error) {
+	key := latestKey(basePath)
+	data, version, err := s.versionPointers().Load(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return &versionPointer{}, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var p versionPointer
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return &p, version, nil
+}
+
+// putVersionPointer writes the pointer of basePath. With an empty version
+// the write only succeeds if there is no pointer yet, otherwise only if it
+// wasn't changed since it was read.
+func (s *S3Storage) putVersionPointer(ctx context.Context, basePath string, p *versionPointer, version string) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode version pointer: %w", err)
+	}
+	_, err = s.versionPointers().Store(ctx, latestKey(basePath), data, version)
+	return err
+}
+
+// versionPointers keeps the latest pointers next to the versions they
+// point to.
+func (s *S3Storage) versionPointers() StateStore {
+	return NewS3StateStore(s, "")
+}
+
+func versionKey(basePath string, n int) string {
+	return strings.TrimSuffix(basePath, "/") + "/v" + strconv.Itoa(n)
+}
+
+func latestKey(basePath string) string {
+	return strings.TrimSuffix(basePath, "/") + "/latest"
+}
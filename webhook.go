@@ -0,0 +1,157 @@
+package s3storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventSave   = "save"
+	EventDelete = "delete"
+)
+
+// ChangeEvent describes a successful mutation.
+type ChangeEvent struct {
+	Type string    `json:"type"`
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// WebhookTarget receives events for keys starting with Prefix.
+// If Secret is set, the body is signed with HMAC-SHA256 and the hex digest
+// is sent in the X-Signature-SHA256 header.
+type WebhookTarget struct {
+	Prefix string
+	URL    string
+	Secret []byte
+}
+
+type WebhookConfig struct {
+	Targets    []WebhookTarget
+	Client     *http.Client
+	MaxRetries int
+	RetryDelay time.Duration
+	// OnError is called when a delivery fails after all retries.
+	OnError func(target WebhookTarget, event ChangeEvent, err error)
+}
+
+// WebhookNotifier wraps a Storage and POSTs a JSON ChangeEvent to matching
+// targets after every successful Save and Delete. Deliveries happen in the
+// background; call Close to wait for pending ones.
+type WebhookNotifier struct {
+	Storage
+	cfg WebhookConfig
+	wg  sync.WaitGroup
+}
+
+// NewWebhookNotifier creates a WebhookNotifier around next.
+func NewWebhookNotifier(next Storage, cfg WebhookConfig) *WebhookNotifier {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 3
+	}
+	if cfg.RetryDelay == 0 {
+		cfg.RetryDelay = time.Second
+	}
+	return &WebhookNotifier{Storage: next, cfg: cfg}
+}
+
+// Save uploads a file and notifies targets on success.
+func (n *WebhookNotifier) Save(ctx context.Context, path string, r io.Reader, opts ...SaveOption) error {
+	if err := n.Storage.Save(ctx, path, r, opts...); err != nil {
+		return err
+	}
+	n.notify(ctx, ChangeEvent{Type: EventSave, Key: path, Time: time.Now().UTC()})
+	return nil
+}
+
+// Delete removes a file and notifies targets on success.
+func (n *WebhookNotifier) Delete(ctx context.Context, path string) error {
+	if err := n.Storage.Delete(ctx, path); err != nil {
+		return err
+	}
+	n.notify(ctx, ChangeEvent{Type: EventDelete, Key: path, Time: time.Now().UTC()})
+	return nil
+}
+
+// Close waits for pending deliveries to finish.
+func (n *WebhookNotifier) Close() error {
+	n.wg.Wait()
+	return nil
+}
+
+func (n *WebhookNotifier) notify(ctx context.Context, event ChangeEvent) {
+	// Deliveries must outlive the request that caused them.
+	ctx = context.WithoutCancel(ctx)
+	for _, target := range n.cfg.Targets {
+		if !strings.HasPrefix(event.Key, target.Prefix) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(target WebhookTarget) {
+			defer n.wg.Done()
+			if err := n.deliver(ctx, target, event); err != nil && n.cfg.OnError != nil {
+				n.cfg.OnError(target, event, err)
+			}
+		}(target)
+	}
+}
+
+func (n *WebhookNotifier) deliver(ctx context.Context, target WebhookTarget, event ChangeEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var signature string
+	if len(target.Secret) > 0 {
+		mac := hmac.New(sha256.New, target.Secret)
+		mac.Write(body)
+		signature = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	delay := n.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = n.post(ctx, target.URL, body, signature)
+		if err == nil || attempt >= n.cfg.MaxRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, url string, body []byte, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set("X-Signature-SHA256", signature)
+	}
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s failed: %w", url, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded with %s", url, resp.Status)
+	}
+	return nil
+}